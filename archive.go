@@ -0,0 +1,375 @@
+package miraihttp
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ArchiveRecord 归档的一条消息
+type ArchiveRecord struct {
+	Time         time.Time    `json:"time"`            // 消息时间
+	Type         string       `json:"type"`            // 消息类型，例如"GroupMessage"
+	Group        int64        `json:"group,omitempty"` // 群号，好友和陌生人消息时为0
+	SenderId     int64        `json:"senderId"`        // 发送者QQ号，同步消息时为0
+	SenderName   string       `json:"senderName"`      // 发送者的群名片或昵称
+	Target       int64        `json:"target"`          // 好友QQ号或群号
+	MessageId    int64        `json:"messageId"`       // 消息id
+	Sent         bool         `json:"sent,omitempty"`  // 是否是Bot发出的消息（包括在其它客户端发出的同步消息）
+	Text         string       `json:"text"`            // 消息的文字描述
+	MessageChain MessageChain `json:"messageChain"`    // 消息链
+}
+
+// ArchiveSink 归档的存储
+type ArchiveSink interface {
+	// Write 写入一条记录
+	Write(record *ArchiveRecord) error
+
+	// Read 读取[from, to)时间范围内的记录，group为0表示读取所有记录
+	Read(group int64, from, to time.Time) ([]*ArchiveRecord, error)
+}
+
+// ExportFormat 导出格式
+type ExportFormat int
+
+const (
+	ExportJSONL ExportFormat = iota // 每行一条json
+	ExportCSV                       // csv表格
+	ExportText                      // 便于阅读的聊天记录
+)
+
+// Archiver 聊天记录归档，记录所有收到和发出的消息。记录在后台协程中写入 ArchiveSink ，用完后需要调用 Close
+type Archiver struct {
+	sink ArchiveSink
+
+	lock      sync.Mutex
+	notFull   *sync.Cond
+	queue     []*ArchiveRecord
+	closed    bool
+	notify    chan struct{}
+	done      chan struct{}
+	writeLock sync.Mutex // 保证按顺序写入
+	dropped   atomic.Int64
+}
+
+// maxArchiveQueue 还没写入的记录数的上限，超过时记录消息的协程会等待
+const maxArchiveQueue = 4096
+
+// NewArchiver 新建一个聊天记录归档
+func NewArchiver(sink ArchiveSink) *Archiver {
+	a := &Archiver{sink: sink, notify: make(chan struct{}, 1), done: make(chan struct{})}
+	a.notFull = sync.NewCond(&a.lock)
+	go a.loop()
+	return a
+}
+
+// Dropped 没有被记录的消息数，包括 Close 之后收到和发出的消息，以及无法复制的消息
+func (a *Archiver) Dropped() int64 {
+	return a.dropped.Load()
+}
+
+// Attach 记录 Bot 收到的所有消息以及发出的消息。
+// 收到的消息在读取消息的协程中记录，因此被 Bot.WaitNext 等到的、没有监听函数的消息也会被记录。
+// 为了不遗漏消息，写入跟不上时记录消息的协程会等待，这时读取消息和发送消息都会变慢
+func (a *Archiver) Attach(b *Bot) {
+	b.archiver.Store(a)
+	b.OnMessageSent(func(message *SentMessage) {
+		a.record(message, func(r *ArchiveRecord) { r.SenderId = b.QQ })
+	})
+}
+
+// record 记录一条消息，message不是消息时忽略，fix用于修改记录，可以为nil
+func (a *Archiver) record(message any, fix func(r *ArchiveRecord)) {
+	r, err := newArchiveRecord(message)
+	if err != nil {
+		a.dropped.Add(1)
+		slog.Error("archive message failed", "error", err)
+		return
+	}
+	if r == nil {
+		return
+	}
+	if fix != nil {
+		fix(r)
+	}
+	a.put(r)
+}
+
+// put 把记录放入写入队列，队列满了时等待
+func (a *Archiver) put(r *ArchiveRecord) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	for !a.closed && len(a.queue) >= maxArchiveQueue {
+		a.notFull.Wait()
+	}
+	if a.closed {
+		a.dropped.Add(1)
+		slog.Error("archive message failed: archiver is closed")
+		return
+	}
+	a.queue = append(a.queue, r)
+	select {
+	case a.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (a *Archiver) loop() {
+	defer close(a.done)
+	for range a.notify {
+		a.flush()
+	}
+	a.flush()
+}
+
+// flush 把队列中的记录写入 ArchiveSink
+func (a *Archiver) flush() {
+	a.writeLock.Lock()
+	defer a.writeLock.Unlock()
+	a.lock.Lock()
+	queue := a.queue
+	a.queue = nil
+	a.notFull.Broadcast()
+	a.lock.Unlock()
+	for _, r := range queue {
+		if err := a.sink.Write(r); err != nil {
+			slog.Error("archive message failed", "error", err)
+		}
+	}
+}
+
+// Close 等待所有记录写入后停止记录，不会关闭 ArchiveSink
+func (a *Archiver) Close() error {
+	a.lock.Lock()
+	if a.closed {
+		a.lock.Unlock()
+		return errors.New("archiver is already closed")
+	}
+	a.closed = true
+	close(a.notify)
+	a.notFull.Broadcast()
+	a.lock.Unlock()
+	<-a.done
+	return nil
+}
+
+// newArchiveRecord 在记录消息的协程中生成记录，其中的消息链是复制的，之后修改消息不会影响记录。message不是消息时返回nil
+func newArchiveRecord(message any) (*ArchiveRecord, error) {
+	target, messageId, ok := messageKey(message)
+	if !ok {
+		return nil, nil
+	}
+	r := &ArchiveRecord{Type: storedMessageType(message), Target: target, MessageId: messageId}
+	switch m := message.(type) {
+	case *FriendMessage:
+		r.SenderId, r.SenderName = m.Sender.Id, m.Sender.Nickname
+	case *GroupMessage:
+		r.Group, r.SenderId, r.SenderName = m.Sender.Group.Id, m.Sender.Id, m.Sender.MemberName
+	case *TempMessage:
+		r.Group, r.SenderId, r.SenderName = m.Sender.Group.Id, m.Sender.Id, m.Sender.MemberName
+	case *StrangerMessage:
+		r.SenderId, r.SenderName = m.Sender.Id, m.Sender.Nickname
+	case *GroupSyncMessage:
+		r.Group = m.Subject.Id
+	case *TempSyncMessage:
+		r.Group = m.Subject.Group.Id
+	case *SentMessage:
+		// 按发往的地方记成对应的消息类型
+		switch m.Target.Kind {
+		case KindGroup:
+			r.Type, r.Group = "GroupMessage", m.Target.Id
+		case KindTemp:
+			r.Type, r.Group = "TempMessage", m.Target.Group
+		default:
+			r.Type = "FriendMessage"
+		}
+		r.Sent = true
+	}
+	// 同步消息是Bot在其它客户端发出的消息
+	switch message.(type) {
+	case *FriendSyncMessage, *GroupSyncMessage, *TempSyncMessage, *StrangerSyncMessage:
+		r.Sent = true
+	}
+	chain, err := copyMessageChain(messageChainOf(message))
+	if err != nil {
+		return nil, err
+	}
+	r.MessageChain = chain
+	r.Text = chain.String()
+	r.Time = time.Unix(chain.Source().Time, 0)
+	return r, nil
+}
+
+// copyMessageChain 通过json复制消息链，并填上每个元素的Type字段，不会修改原来的消息链
+func copyMessageChain(chain MessageChain) (MessageChain, error) {
+	filled := make(MessageChain, 0, len(chain))
+	for _, m := range chain {
+		if m == nil {
+			continue
+		}
+		v := reflect.New(reflect.TypeOf(m).Elem())
+		v.Elem().Set(reflect.ValueOf(m).Elem())
+		m = v.Interface().(SingleMessage)
+		m.FillMessageType()
+		filled = append(filled, m)
+	}
+	buf, err := json.Marshal(filled)
+	if err != nil {
+		return nil, err
+	}
+	var ret MessageChain
+	if err = json.Unmarshal(buf, &ret); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// Export 导出[from, to)时间范围内某个群的聊天记录，group为0表示导出所有记录。
+// 导出前会先写入队列中的记录。CSV格式中的direction列为sent表示Bot发出的消息，received表示收到的消息
+func (a *Archiver) Export(w io.Writer, group int64, from, to time.Time, format ExportFormat) error {
+	a.flush()
+	records, err := a.sink.Read(group, from, to)
+	if err != nil {
+		return err
+	}
+	switch format {
+	case ExportJSONL:
+		enc := json.NewEncoder(w)
+		for _, r := range records {
+			if err = enc.Encode(r); err != nil {
+				return err
+			}
+		}
+		return nil
+	case ExportCSV:
+		cw := csv.NewWriter(w)
+		if err = cw.Write([]string{"time", "type", "direction", "group", "senderId", "senderName", "messageId", "text"}); err != nil {
+			return err
+		}
+		for _, r := range records {
+			direction := "received"
+			if r.Sent {
+				direction = "sent"
+			}
+			if err = cw.Write([]string{r.Time.Format(time.DateTime), r.Type, direction, strconv.FormatInt(r.Group, 10),
+				strconv.FormatInt(r.SenderId, 10), r.SenderName, strconv.FormatInt(r.MessageId, 10), r.Text}); err != nil {
+				return err
+			}
+		}
+		cw.Flush()
+		return cw.Error()
+	case ExportText:
+		for _, r := range records {
+			sender := fmt.Sprintf("%s(%d)", r.SenderName, r.SenderId)
+			if r.Sent {
+				sender = "[Bot]" + sender
+			}
+			if _, err = fmt.Fprintf(w, "[%s] %s: %s\n", r.Time.Format(time.DateTime), sender, r.Text); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown export format: %d", format)
+	}
+}
+
+// JSONLArchiveSink 按天把记录写入 dir/2006-01-02.jsonl 文件
+type JSONLArchiveSink struct {
+	dir  string
+	lock sync.Mutex
+	day  string
+	f    *os.File
+}
+
+// NewJSONLArchiveSink 新建一个按天滚动的jsonl文件归档存储，目录不存在时会自动创建
+func NewJSONLArchiveSink(dir string) (*JSONLArchiveSink, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &JSONLArchiveSink{dir: dir}, nil
+}
+
+func (s *JSONLArchiveSink) fileName(day string) string {
+	return filepath.Join(s.dir, day+".jsonl")
+}
+
+func (s *JSONLArchiveSink) Write(record *ArchiveRecord) error {
+	buf, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	day := record.Time.Format(time.DateOnly)
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.f == nil || s.day != day {
+		if s.f != nil {
+			_ = s.f.Close()
+			s.f = nil
+		}
+		f, err := os.OpenFile(s.fileName(day), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+		if err != nil {
+			return err
+		}
+		s.f, s.day = f, day
+	}
+	_, err = s.f.Write(append(buf, '\n'))
+	return err
+}
+
+func (s *JSONLArchiveSink) Read(group int64, from, to time.Time) ([]*ArchiveRecord, error) {
+	if !from.Before(to) {
+		return nil, errors.New("invalid time range")
+	}
+	var records []*ArchiveRecord
+	from, to = from.Local(), to.Local()
+	for day := time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, time.Local); day.Before(to); day = day.AddDate(0, 0, 1) {
+		f, err := os.Open(s.fileName(day.Format(time.DateOnly)))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		scanner := bufio.NewScanner(f)
+		scanner.Buffer(nil, 16<<20)
+		for scanner.Scan() {
+			r := &ArchiveRecord{}
+			if err = json.Unmarshal(scanner.Bytes(), r); err != nil {
+				slog.Error("invalid archive record", "error", err)
+				continue
+			}
+			if (group == 0 || r.Group == group) && !r.Time.Before(from) && r.Time.Before(to) {
+				records = append(records, r)
+			}
+		}
+		err = scanner.Err()
+		_ = f.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return records, nil
+}
+
+// Close 关闭当前正在写入的文件
+func (s *JSONLArchiveSink) Close() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.f == nil {
+		return nil
+	}
+	err := s.f.Close()
+	s.f = nil
+	return err
+}
@@ -0,0 +1,109 @@
+package miraihttp
+
+import (
+	"bytes"
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestArchiver(t *testing.T) {
+	sink, err := NewJSONLArchiveSink(t.TempDir())
+	assert.Nil(t, err)
+	defer func() { _ = sink.Close() }()
+	a := NewArchiver(sink)
+	day1 := time.Date(2024, 5, 1, 23, 59, 0, 0, time.Local)
+	day2 := day1.Add(2 * time.Minute)
+	a.record(&GroupMessage{
+		Sender:       Member{Id: 2, MemberName: "a", Group: Group{Id: 1}},
+		MessageChain: MessageChain{&Source{Id: 3, Time: day1.Unix()}, &Plain{Text: "hello, world"}},
+	}, nil)
+	a.record(&GroupMessage{
+		Sender:       Member{Id: 10, Group: Group{Id: 1}},
+		MessageChain: MessageChain{&Source{Id: 4, Time: day2.Unix()}, &At{Target: 2}},
+	}, func(r *ArchiveRecord) { r.Sent = true })
+	a.record(&FriendMessage{
+		Sender:       Friend{Id: 5, Nickname: "f"},
+		MessageChain: MessageChain{&Source{Id: 6, Time: day2.Unix()}, &Plain{Text: "x"}},
+	}, nil)
+
+	var buf bytes.Buffer
+	assert.Nil(t, a.Export(&buf, 1, day1, day2.Add(time.Minute), ExportText))
+	assert.Equal(t, "[2024-05-01 23:59:00] a(2): hello, world\n[2024-05-02 00:01:00] [Bot](10): @2\n", buf.String())
+
+	buf.Reset()
+	assert.Nil(t, a.Export(&buf, 1, day1, day2.Add(time.Minute), ExportCSV))
+	assert.Equal(t, "time,type,direction,group,senderId,senderName,messageId,text\n"+
+		"2024-05-01 23:59:00,GroupMessage,received,1,2,a,3,\"hello, world\"\n"+
+		"2024-05-02 00:01:00,GroupMessage,sent,1,10,,4,@2\n", buf.String())
+
+	records, err := sink.Read(0, day1, day2.Add(time.Minute))
+	assert.Nil(t, err)
+	assert.Len(t, records, 3)
+	assert.Equal(t, "hello, world", records[0].MessageChain.PlainText())
+
+	// 记录的是消息链的副本，不会修改原来的消息，之后修改消息也不影响记录
+	plain := &Plain{Text: "before"}
+	a.record(&FriendMessage{Sender: Friend{Id: 5}, MessageChain: MessageChain{&Source{Id: 7, Time: day2.Unix()}, plain}}, nil)
+	assert.Empty(t, plain.Type)
+	plain.Text = "after"
+	buf.Reset()
+	assert.Nil(t, a.Export(&buf, 0, day2, day2.Add(time.Minute), ExportText))
+	assert.Contains(t, buf.String(), "(5): before\n")
+	assert.NotContains(t, buf.String(), "after")
+
+	assert.Nil(t, a.Close())
+	assert.NotNil(t, a.Close())
+	assert.Zero(t, a.Dropped())
+	a.record(&FriendMessage{Sender: Friend{Id: 5}, MessageChain: MessageChain{&Source{Id: 8, Time: day2.Unix()}}}, nil)
+	assert.Equal(t, int64(1), a.Dropped())
+}
+
+func TestArchiverAttach(t *testing.T) {
+	s, b := newTestBot(t, nil)
+	sink, err := NewJSONLArchiveSink(t.TempDir())
+	require.Nil(t, err)
+	defer func() { _ = sink.Close() }()
+	a := NewArchiver(sink)
+	a.Attach(b)
+
+	// 没有监听函数的消息和被WaitNext等到的消息也会被记录
+	now := time.Now().Unix()
+	waited := make(chan struct{})
+	go func() {
+		defer close(waited)
+		_, err := WaitNextMessage[*FriendMessage](context.Background(), b, nil)
+		assert.Nil(t, err)
+	}()
+	assert.Eventually(t, b.hasWaiter, time.Second, time.Millisecond)
+	s.Push(t, `{"type":"FriendMessage","sender":{"id":5,"nickname":"f"},"messageChain":[{"type":"Source","id":1,"time":`+strconv.FormatInt(now, 10)+`},{"type":"Plain","text":"a"}]}`)
+	<-waited
+	s.Push(t, `{"type":"GroupMessage","sender":{"id":2,"memberName":"m","group":{"id":1}},"messageChain":[{"type":"Source","id":2,"time":`+strconv.FormatInt(now, 10)+`},{"type":"Plain","text":"b"}]}`)
+	_, err = b.SendGroupMessage(1, 0, MessageChain{&Plain{Text: "c"}})
+	require.Nil(t, err)
+
+	from, to := time.Unix(now-60, 0), time.Now().Add(time.Minute)
+	var buf bytes.Buffer
+	assert.Eventually(t, func() bool {
+		buf.Reset()
+		return a.Export(&buf, 0, from, to, ExportCSV) == nil && strings.Count(buf.String(), "\n") == 4
+	}, time.Second, 10*time.Millisecond)
+	assert.Nil(t, a.Close())
+	records, err := sink.Read(0, from, to)
+	require.Nil(t, err)
+	require.Len(t, records, 3)
+	texts := make([]string, 0, len(records))
+	for _, r := range records {
+		texts = append(texts, r.Text)
+		if r.Text == "c" {
+			assert.True(t, r.Sent)
+			assert.Equal(t, int64(1), r.Group)
+			assert.Equal(t, b.QQ, r.SenderId)
+		}
+	}
+	assert.ElementsMatch(t, []string{"a", "b", "c"}, texts)
+}
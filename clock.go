@@ -0,0 +1,97 @@
+package miraihttp
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Timer 由 Clock.AfterFunc 返回的定时器
+type Timer interface {
+	// Stop 停止定时器，如果定时器已经触发或者已经停止则返回false
+	Stop() bool
+}
+
+// Clock 时间来源。监听函数的超时、请求的超时和 Bot.WithTimeout 使用它计时，测试时可以替换为 miraitest.FakeClock
+type Clock interface {
+	Now() time.Time
+	AfterFunc(d time.Duration, f func()) Timer
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) AfterFunc(d time.Duration, f func()) Timer {
+	return time.AfterFunc(d, f)
+}
+
+// SetClock 设置时间来源，为nil表示使用系统时间
+func (b *Bot) SetClock(c Clock) {
+	if c == nil {
+		b.clock.Store(nil)
+		return
+	}
+	b.clock.Store(&c)
+}
+
+// Clock 获取时间来源
+func (b *Bot) Clock() Clock {
+	if c := b.clock.Load(); c != nil {
+		return *c
+	}
+	return realClock{}
+}
+
+// WithTimeout 与 context.WithTimeout 相同，但是用 Bot 的 Clock 计时，例如在监听函数中等待下一条消息时：
+//
+//	ctx, cancel := b.WithTimeout(context.Background(), time.Minute)
+//	defer cancel()
+//	next, err := message.WaitNextFromSender(ctx, b)
+func (b *Bot) WithTimeout(parent context.Context, d time.Duration) (context.Context, context.CancelFunc) {
+	clock := b.Clock()
+	ctx := &clockContext{Context: parent, deadline: clock.Now().Add(d), done: make(chan struct{})}
+	timer := clock.AfterFunc(d, func() { ctx.cancel(context.DeadlineExceeded) })
+	stop := context.AfterFunc(parent, func() { ctx.cancel(parent.Err()) })
+	return ctx, func() {
+		timer.Stop()
+		stop()
+		ctx.cancel(context.Canceled)
+	}
+}
+
+type clockContext struct {
+	context.Context
+	deadline time.Time
+	done     chan struct{}
+	lock     sync.Mutex
+	err      error
+}
+
+func (c *clockContext) cancel(err error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.err == nil {
+		c.err = err
+		close(c.done)
+	}
+}
+
+func (c *clockContext) Deadline() (time.Time, bool) {
+	if d, ok := c.Context.Deadline(); ok && d.Before(c.deadline) {
+		return d, true
+	}
+	return c.deadline, true
+}
+
+func (c *clockContext) Done() <-chan struct{} {
+	return c.done
+}
+
+func (c *clockContext) Err() error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.err
+}
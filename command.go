@@ -0,0 +1,424 @@
+package miraihttp
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// CommandScope 命令可以在哪些场景下使用，可以用 | 组合
+type CommandScope int
+
+const (
+	ScopeGroup  CommandScope = 1 << iota // 群消息
+	ScopeFriend                          // 好友消息
+	ScopeTemp                            // 群临时会话消息
+
+	ScopeAll = ScopeGroup | ScopeFriend | ScopeTemp // 所有场景
+)
+
+// ArgType 命令参数的类型
+type ArgType int
+
+const (
+	ArgString ArgType = iota // 字符串，可以用双引号或单引号包起来以包含空格
+	ArgInt                   // 整数
+	ArgQQ                    // QQ号，可以是@某人，也可以直接填QQ号
+	ArgRest                  // 剩余的所有内容，只能作为最后一个参数
+)
+
+// ArgSpec 命令参数的定义
+type ArgSpec struct {
+	Name     string  // 参数名，用于在 CommandContext 中取值和生成帮助
+	Type     ArgType // 参数类型
+	Optional bool    // 是否可选，可选参数只能在必填参数之后
+}
+
+func (a *ArgSpec) usage() string {
+	if a.Optional {
+		return "[" + a.Name + "]"
+	}
+	return "<" + a.Name + ">"
+}
+
+// Command 命令
+type Command struct {
+	Name        string       // 命令名，不含前缀
+	Aliases     []string     // 别名
+	Description string       // 命令描述，用于生成帮助
+	Args        []ArgSpec    // 参数定义
+	Scope       CommandScope // 可以使用的场景，为0表示 ScopeAll
+	Perm        Perm         // 在群里使用时需要的最低权限，为空表示不限。限制了权限的命令不能在好友消息中使用
+
+	// Handler 命令的处理函数
+	Handler func(ctx *CommandContext)
+}
+
+// CommandContext 命令被触发时的上下文
+type CommandContext struct {
+	Bot     *Bot
+	Command *Command
+	Message any     // 触发命令的消息，是 *GroupMessage, *FriendMessage, *TempMessage 之一
+	Sender  int64   // 发送者QQ号
+	Subject Subject // 消息来源，回复消息时发往这里
+	Perm    Perm    // 发送者在群中的权限，好友消息时为空
+
+	args map[string]any
+}
+
+// Has 可选参数是否被填写
+func (c *CommandContext) Has(name string) bool {
+	_, ok := c.args[name]
+	return ok
+}
+
+// String 获取 ArgString 或 ArgRest 类型的参数
+func (c *CommandContext) String(name string) string {
+	s, _ := c.args[name].(string)
+	return s
+}
+
+// Int 获取 ArgInt 类型的参数
+func (c *CommandContext) Int(name string) int64 {
+	i, _ := c.args[name].(int64)
+	return i
+}
+
+// QQ 获取 ArgQQ 类型的参数
+func (c *CommandContext) QQ(name string) int64 {
+	return c.Int(name)
+}
+
+// Reply 向消息来源回复消息
+func (c *CommandContext) Reply(messageChain MessageChain) (int64, error) {
+	return c.Subject.Send(c.Bot, 0, messageChain)
+}
+
+// ReplyText 向消息来源回复一条文字消息
+func (c *CommandContext) ReplyText(text string) (int64, error) {
+	return c.Reply(MessageChain{&Plain{Text: text}})
+}
+
+// CommandRouter 命令路由，注册到 Bot 上之后，会自动解析 /cmd arg1 arg2 形式的消息并调用对应的命令。
+// 消息开头@机器人也可以，例如“@机器人 /cmd arg1”。注册到 Bot 上之后仍然可以继续 Register
+type CommandRouter struct {
+	Prefix string // 命令前缀，例如"/"
+
+	lock     sync.RWMutex
+	commands map[string]*Command
+	list     []*Command
+}
+
+// NewCommandRouter 新建一个命令路由，会自动注册一个 help 命令
+func NewCommandRouter(prefix string) *CommandRouter {
+	r := &CommandRouter{Prefix: prefix, commands: make(map[string]*Command)}
+	_ = r.Register(&Command{
+		Name:        "help",
+		Aliases:     []string{"帮助"},
+		Description: "查看命令帮助",
+		Args:        []ArgSpec{{Name: "命令", Type: ArgString, Optional: true}},
+		Handler: func(ctx *CommandContext) {
+			var text string
+			if ctx.Has("命令") {
+				text = r.CommandHelp(ctx.String("命令"))
+			} else {
+				text = r.Help(scopeOf(ctx.Message), ctx.Perm)
+			}
+			if _, err := ctx.ReplyText(text); err != nil {
+				slog.Error("reply help failed", "error", err)
+			}
+		},
+	})
+	return r
+}
+
+// Register 注册命令，命令名或别名重复时返回错误
+func (r *CommandRouter) Register(cmd *Command) error {
+	if cmd.Name == "" || cmd.Handler == nil {
+		return errors.New("command name and handler are required")
+	}
+	for i := range cmd.Args {
+		if cmd.Args[i].Type == ArgRest && i != len(cmd.Args)-1 {
+			return fmt.Errorf("command %s: rest argument must be the last one", cmd.Name)
+		}
+		if i > 0 && cmd.Args[i-1].Optional && !cmd.Args[i].Optional {
+			return fmt.Errorf("command %s: required argument after optional argument", cmd.Name)
+		}
+	}
+	names := append([]string{cmd.Name}, cmd.Aliases...)
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	for _, name := range names {
+		if _, ok := r.commands[name]; ok {
+			return fmt.Errorf("duplicate command: %s", name)
+		}
+	}
+	for _, name := range names {
+		r.commands[name] = cmd
+	}
+	r.list = append(r.list, cmd)
+	return nil
+}
+
+// Attach 把命令路由注册到 Bot 的群消息、好友消息和群临时会话消息监听上
+func (r *CommandRouter) Attach(b *Bot) {
+	b.ListenGroupMessage(func(message *GroupMessage) bool {
+		return r.dispatch(b, message, message.MessageChain, message.Subject(), message.Sender.Id, message.Sender.Permission)
+	})
+	b.ListenFriendMessage(func(message *FriendMessage) bool {
+		return r.dispatch(b, message, message.MessageChain, message.Subject(), message.Sender.Id, "")
+	})
+	b.ListenTempMessage(func(message *TempMessage) bool {
+		return r.dispatch(b, message, message.MessageChain, message.Subject(), message.Sender.Id, message.Sender.Permission)
+	})
+}
+
+func scopeOf(message any) CommandScope {
+	switch message.(type) {
+	case *GroupMessage:
+		return ScopeGroup
+	case *FriendMessage:
+		return ScopeFriend
+	case *TempMessage:
+		return ScopeTemp
+	default:
+		return 0
+	}
+}
+
+var permLevel = map[Perm]int{"": 0, PermMember: 0, PermAdministrator: 1, PermOwner: 2}
+
+func (cmd *Command) available(scope CommandScope, perm Perm) bool {
+	return cmd.inScope(scope) && cmd.permitted(scope, perm)
+}
+
+func (cmd *Command) inScope(scope CommandScope) bool {
+	s := cmd.Scope
+	if s == 0 {
+		s = ScopeAll
+	}
+	return s&scope != 0
+}
+
+func (cmd *Command) permitted(scope CommandScope, perm Perm) bool {
+	if permLevel[cmd.Perm] == 0 {
+		return true
+	}
+	return scope != ScopeFriend && permLevel[perm] >= permLevel[cmd.Perm]
+}
+
+// dispatch 返回值同监听函数，如果消息是命令，返回false，不再让后续监听处理。
+// 不能在这个场景使用的命令会被当作普通消息，交给后续监听处理
+func (r *CommandRouter) dispatch(b *Bot, message any, messageChain MessageChain, subject Subject, sender int64, perm Perm) bool {
+	tokens := tokenize(messageChain)
+	if len(tokens) > 0 && tokens[0].isAt && tokens[0].qq == b.QQ {
+		tokens = tokens[1:]
+	}
+	if len(tokens) == 0 || tokens[0].isAt || !strings.HasPrefix(tokens[0].text, r.Prefix) {
+		return true
+	}
+	cmd, ok := r.command(strings.TrimPrefix(tokens[0].text, r.Prefix))
+	if !ok {
+		return true
+	}
+	scope := scopeOf(message)
+	if !cmd.inScope(scope) {
+		return true
+	}
+	ctx := &CommandContext{Bot: b, Command: cmd, Message: message, Sender: sender, Subject: subject, Perm: perm}
+	if !cmd.permitted(scope, perm) {
+		if _, err := ctx.ReplyText("你没有权限使用这个命令"); err != nil {
+			slog.Error("reply failed", "error", err)
+		}
+		return false
+	}
+	args, err := cmd.parseArgs(tokens[1:])
+	if err != nil {
+		if _, err := ctx.ReplyText(err.Error() + "\n用法：" + r.usage(cmd)); err != nil {
+			slog.Error("reply failed", "error", err)
+		}
+		return false
+	}
+	ctx.args = args
+	cmd.Handler(ctx)
+	return false
+}
+
+func (r *CommandRouter) command(name string) (*Command, bool) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	cmd, ok := r.commands[name]
+	return cmd, ok
+}
+
+func (cmd *Command) parseArgs(tokens []token) (map[string]any, error) {
+	args := make(map[string]any, len(cmd.Args))
+	for i, spec := range cmd.Args {
+		if i >= len(tokens) {
+			if spec.Optional {
+				break
+			}
+			return nil, fmt.Errorf("缺少参数：%s", spec.Name)
+		}
+		tok := tokens[i]
+		switch spec.Type {
+		case ArgString:
+			if tok.isAt {
+				args[spec.Name] = strconv.FormatInt(tok.qq, 10)
+			} else {
+				args[spec.Name] = tok.text
+			}
+		case ArgInt:
+			n, err := strconv.ParseInt(tok.text, 10, 64)
+			if tok.isAt || err != nil {
+				return nil, fmt.Errorf("参数%s必须是整数", spec.Name)
+			}
+			args[spec.Name] = n
+		case ArgQQ:
+			if tok.isAt {
+				args[spec.Name] = tok.qq
+			} else if n, err := strconv.ParseInt(tok.text, 10, 64); err == nil && n > 0 {
+				args[spec.Name] = n
+			} else {
+				return nil, fmt.Errorf("参数%s必须是QQ号或者@某人", spec.Name)
+			}
+		case ArgRest:
+			args[spec.Name] = strings.TrimSpace(tok.rest)
+			return args, nil
+		}
+	}
+	if len(tokens) > len(cmd.Args) {
+		return nil, errors.New("参数过多")
+	}
+	return args, nil
+}
+
+func (r *CommandRouter) usage(cmd *Command) string {
+	var sb strings.Builder
+	sb.WriteString(r.Prefix + cmd.Name)
+	for i := range cmd.Args {
+		sb.WriteString(" " + cmd.Args[i].usage())
+	}
+	return sb.String()
+}
+
+// Help 生成在指定场景下、指定权限可以使用的所有命令的帮助
+func (r *CommandRouter) Help(scope CommandScope, perm Perm) string {
+	var lines []string
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	for _, cmd := range r.list {
+		if cmd.available(scope, perm) {
+			lines = append(lines, r.usage(cmd)+"  "+cmd.Description)
+		}
+	}
+	sort.Strings(lines)
+	return "可用的命令：\n" + strings.Join(lines, "\n")
+}
+
+// CommandHelp 生成单个命令的帮助，name可以带前缀，也可以是别名
+func (r *CommandRouter) CommandHelp(name string) string {
+	cmd, ok := r.command(strings.TrimPrefix(name, r.Prefix))
+	if !ok {
+		return "没有这个命令：" + name
+	}
+	text := "用法：" + r.usage(cmd)
+	if cmd.Description != "" {
+		text += "\n" + cmd.Description
+	}
+	if len(cmd.Aliases) > 0 {
+		text += "\n别名：" + strings.Join(cmd.Aliases, "、")
+	}
+	return text
+}
+
+// token 命令中的一个词，At会被单独作为一个词
+type token struct {
+	text string
+	isAt bool
+	qq   int64
+	rest string // 从这个词开始的剩余内容
+}
+
+// tokenize 把消息链切分成词，文字按空白切分，引号中的内容作为一个词，其它非文字、非At的消息会被忽略。
+// 相邻的文字会先拼接起来再切分
+func tokenize(messageChain MessageChain) []token {
+	var full strings.Builder
+	type piece struct {
+		token
+		start int
+	}
+	var pieces []piece
+	base := 0 // 还没有切分的文字在full中的开始位置
+	flushPlain := func() {
+		for _, w := range splitWords(full.String()[base:]) {
+			pieces = append(pieces, piece{token{text: w.text}, base + w.start})
+		}
+	}
+	for _, m := range messageChain {
+		switch m := m.(type) {
+		case *At:
+			flushPlain()
+			pieces = append(pieces, piece{token{text: "@" + strconv.FormatInt(m.Target, 10), isAt: true, qq: m.Target}, full.Len()})
+			full.WriteString("@" + strconv.FormatInt(m.Target, 10) + " ")
+			base = full.Len()
+		case *Plain:
+			full.WriteString(m.Text)
+		}
+	}
+	flushPlain()
+	s := full.String()
+	tokens := make([]token, 0, len(pieces))
+	for _, p := range pieces {
+		p.rest = s[p.start:]
+		tokens = append(tokens, p.token)
+	}
+	return tokens
+}
+
+type word struct {
+	text  string
+	start int
+}
+
+func splitWords(s string) []word {
+	var words []word
+	var sb strings.Builder
+	start, inWord := 0, false
+	var quote rune
+	for i, c := range s {
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			} else {
+				sb.WriteRune(c)
+			}
+		case c == '"' || c == '\'':
+			if !inWord {
+				start, inWord = i, true
+			}
+			quote = c
+		case unicode.IsSpace(c):
+			if inWord {
+				words = append(words, word{sb.String(), start})
+				sb.Reset()
+				inWord = false
+			}
+		default:
+			if !inWord {
+				start, inWord = i, true
+			}
+			sb.WriteRune(c)
+		}
+	}
+	if inWord {
+		words = append(words, word{sb.String(), start})
+	}
+	return words
+}
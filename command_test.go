@@ -0,0 +1,72 @@
+package miraihttp
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strconv"
+	"testing"
+)
+
+func TestCommandRouter(t *testing.T) {
+	r := NewCommandRouter("/")
+	var got *CommandContext
+	assert.Nil(t, r.Register(&Command{
+		Name:    "ban",
+		Aliases: []string{"禁言"},
+		Args: []ArgSpec{
+			{Name: "qq", Type: ArgQQ},
+			{Name: "minutes", Type: ArgInt},
+			{Name: "reason", Type: ArgRest, Optional: true},
+		},
+		Scope:   ScopeGroup,
+		Perm:    PermAdministrator,
+		Handler: func(ctx *CommandContext) { got = ctx },
+	}))
+	assert.NotNil(t, r.Register(&Command{Name: "禁言", Handler: func(*CommandContext) {}}))
+
+	message := &GroupMessage{
+		Sender: Member{Id: 1, Permission: PermOwner, Group: Group{Id: 2}},
+		MessageChain: MessageChain{
+			&Source{Id: 1},
+			&Plain{Text: "/禁言 "},
+			&At{Target: 3},
+			&Plain{Text: ` 10 "spam  a lot" ok`},
+		},
+	}
+	b := &Bot{QQ: 10}
+	assert.False(t, r.dispatch(b, message, message.MessageChain, message.Subject(), 1, PermOwner))
+	assert.NotNil(t, got)
+	assert.Equal(t, int64(3), got.QQ("qq"))
+	assert.Equal(t, int64(10), got.Int("minutes"))
+	assert.Equal(t, `"spam  a lot" ok`, got.String("reason"))
+
+	assert.True(t, r.dispatch(b, message, MessageChain{&Plain{Text: "hello"}}, message.Subject(), 1, PermOwner))
+	assert.True(t, r.dispatch(b, message, MessageChain{&Plain{Text: "/unknown"}}, message.Subject(), 1, PermOwner))
+
+	got = nil
+	chain := MessageChain{&At{Target: 10}, &Plain{Text: " /b"}, &Plain{Text: "an "}, &At{Target: 3}, &Plain{Text: " 5"}}
+	assert.False(t, r.dispatch(b, message, chain, message.Subject(), 1, PermOwner))
+	assert.NotNil(t, got)
+	assert.Equal(t, int64(5), got.Int("minutes"))
+	assert.True(t, r.dispatch(b, message, MessageChain{&At{Target: 11}, &Plain{Text: " /ban 3 5"}}, message.Subject(), 1, PermOwner))
+
+	// 不能在好友消息中使用的命令交给后续监听处理
+	friendMessage := &FriendMessage{Sender: Friend{Id: 1}}
+	assert.True(t, r.dispatch(b, friendMessage, MessageChain{&Plain{Text: "/ban 3 5"}}, friendMessage.Subject(), 1, ""))
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			_ = r.Register(&Command{Name: "c" + strconv.Itoa(i), Handler: func(*CommandContext) {}})
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		r.dispatch(b, message, MessageChain{&Plain{Text: "/c" + strconv.Itoa(i)}}, message.Subject(), 1, PermOwner)
+	}
+	<-done
+
+	assert.Equal(t, []word{{"a", 0}, {"b c", 2}, {"d", 9}}, splitWords(`a "b c"  d`))
+	assert.Contains(t, r.Help(ScopeGroup, PermAdministrator), "/ban <qq> <minutes> [reason]")
+	assert.NotContains(t, r.Help(ScopeGroup, PermMember), "/ban")
+	assert.Contains(t, r.CommandHelp("/禁言"), "别名：禁言")
+}
@@ -0,0 +1,335 @@
+package miraihttp
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// ContactCache 好友、群和群成员的本地缓存，由事件自动保持更新。
+// 所有方法都可以在nil上调用，此时总是找不到。
+type ContactCache struct {
+	b   *Bot
+	ttl time.Duration
+
+	lock    sync.RWMutex
+	friends map[int64]Friend
+	groups  map[int64]*cachedGroup
+	loading bool          // 是否正在 EnableContactCache 中拉取列表
+	backlog []any         // 拉取列表期间收到的事件，拉取完成后应用
+	prev    *ContactCache // 拉取列表期间仍然更新的原来的缓存，拉取失败时恢复它
+}
+
+type cachedGroup struct {
+	group      Group
+	members    map[int64]Member
+	updateTime time.Time
+	refreshing bool
+	pending    []any // 刷新期间收到的与这个群有关的事件
+}
+
+// EnableContactCache 开启联系人缓存，会立即拉取好友列表、群列表和所有群的成员列表。
+// 拉取期间收到的事件会在拉取完成后应用到缓存上，拉取期间查询缓存总是找不到。
+// ttl-群成员列表的有效期，过期后在下次查询时会在后台通过 LatestMemberList 刷新，为0表示不刷新，只依靠事件更新
+func (b *Bot) EnableContactCache(ttl time.Duration) error {
+	c := &ContactCache{b: b, ttl: ttl, friends: make(map[int64]Friend), groups: make(map[int64]*cachedGroup), loading: true}
+	c.prev = b.cache.Swap(c)
+	if err := c.load(); err != nil {
+		b.cache.CompareAndSwap(c, c.prev)
+		return err
+	}
+	return nil
+}
+
+// load 拉取好友列表、群列表和所有群的成员列表，再应用拉取期间收到的事件
+func (c *ContactCache) load() error {
+	friends, err := c.b.FriendList()
+	if err != nil {
+		return err
+	}
+	groups, err := c.b.GroupList()
+	if err != nil {
+		return err
+	}
+	members := make([][]*Member, len(groups))
+	for i, g := range groups {
+		if members[i], err = c.b.MemberList(g.Id); err != nil {
+			return err
+		}
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for _, f := range friends {
+		c.friends[f.Id] = *f
+	}
+	for i, g := range groups {
+		c.groups[g.Id] = newCachedGroup(*g, members[i])
+	}
+	for _, event := range c.backlog {
+		c.apply(event)
+	}
+	c.loading, c.backlog, c.prev = false, nil, nil
+	return nil
+}
+
+// Cache 获取联系人缓存，没有调用过 EnableContactCache 时返回nil
+func (b *Bot) Cache() *ContactCache {
+	return b.cache.Load()
+}
+
+func newCachedGroup(group Group, members []*Member) *cachedGroup {
+	g := &cachedGroup{group: group, members: make(map[int64]Member, len(members)), updateTime: time.Now()}
+	for _, m := range members {
+		g.members[m.Id] = *m
+	}
+	return g
+}
+
+// Friend 查询好友
+func (c *ContactCache) Friend(qq int64) (*Friend, bool) {
+	if c == nil {
+		return nil, false
+	}
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	f, ok := c.friends[qq]
+	if !ok {
+		return nil, false
+	}
+	return &f, true
+}
+
+// Friends 获取所有好友
+func (c *ContactCache) Friends() []*Friend {
+	if c == nil {
+		return nil
+	}
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	ret := make([]*Friend, 0, len(c.friends))
+	for _, f := range c.friends {
+		ret = append(ret, &f)
+	}
+	return ret
+}
+
+// Group 查询群
+func (c *ContactCache) Group(group int64) (*Group, bool) {
+	if c == nil {
+		return nil, false
+	}
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	g, ok := c.groups[group]
+	if !ok {
+		return nil, false
+	}
+	ret := g.group
+	return &ret, true
+}
+
+// Groups 获取所有群
+func (c *ContactCache) Groups() []*Group {
+	if c == nil {
+		return nil
+	}
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	ret := make([]*Group, 0, len(c.groups))
+	for _, g := range c.groups {
+		group := g.group
+		ret = append(ret, &group)
+	}
+	return ret
+}
+
+// Member 查询群成员
+func (c *ContactCache) Member(group, qq int64) (*Member, bool) {
+	if c == nil {
+		return nil, false
+	}
+	c.checkExpired(group)
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	g, ok := c.groups[group]
+	if !ok {
+		return nil, false
+	}
+	m, ok := g.members[qq]
+	if !ok {
+		return nil, false
+	}
+	return &m, true
+}
+
+// Members 获取群的所有成员
+func (c *ContactCache) Members(group int64) []*Member {
+	if c == nil {
+		return nil
+	}
+	c.checkExpired(group)
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	g, ok := c.groups[group]
+	if !ok {
+		return nil
+	}
+	ret := make([]*Member, 0, len(g.members))
+	for _, m := range g.members {
+		ret = append(ret, &m)
+	}
+	return ret
+}
+
+// checkExpired 如果群成员列表过期了，则在后台刷新
+func (c *ContactCache) checkExpired(group int64) {
+	if c.ttl <= 0 {
+		return
+	}
+	c.lock.RLock()
+	g, ok := c.groups[group]
+	expired := ok && !g.refreshing && time.Since(g.updateTime) >= c.ttl
+	c.lock.RUnlock()
+	if !expired {
+		return
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.groups[group] != g || g.refreshing {
+		return
+	}
+	g.refreshing = true
+	go c.refresh(g, true)
+}
+
+// refresh 重新拉取群成员列表，不能在读取消息的协程中调用。
+// 拉取期间收到的与这个群有关的事件会在拉取完成后重新应用到新的成员列表上
+func (c *ContactCache) refresh(g *cachedGroup, latest bool) {
+	var members []*Member
+	var err error
+	if latest {
+		members, err = c.b.LatestMemberList(g.group.Id, nil)
+	} else {
+		members, err = c.b.MemberList(g.group.Id)
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.groups[g.group.Id] != g {
+		// 刷新期间Bot退出了这个群
+		return
+	}
+	if err != nil {
+		slog.Error("refresh member list failed", "group", g.group.Id, "error", err)
+		g.refreshing = false
+		g.pending = nil
+		return
+	}
+	c.groups[g.group.Id] = newCachedGroup(g.group, members)
+	for _, event := range g.pending {
+		c.apply(event)
+	}
+}
+
+// handleEvent 根据事件更新缓存，在读取消息的协程中调用，不能发起请求
+func (c *ContactCache) handleEvent(event any) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.loading {
+		c.backlog = append(c.backlog, event)
+		if c.prev != nil {
+			c.prev.handleEvent(event)
+		}
+		return
+	}
+	c.apply(event)
+}
+
+// apply 根据事件更新缓存，调用时需要持有写锁
+func (c *ContactCache) apply(event any) {
+	switch e := event.(type) {
+	case *GroupMessage:
+		c.putMember(event, e.Sender)
+	case *TempMessage:
+		c.putMember(event, e.Sender)
+	case *MemberJoinEvent:
+		c.putMember(event, e.Member)
+	case *MemberLeaveEventKick:
+		c.removeMember(event, e.Member)
+	case *MemberLeaveEventQuit:
+		c.removeMember(event, e.Member)
+	case *MemberCardChangeEvent:
+		c.updateMember(event, e.Member, func(m *Member) { m.MemberName = e.Current })
+	case *MemberSpecialTitleChangeEvent:
+		c.updateMember(event, e.Member, func(m *Member) { m.SpecialTitle = e.Current })
+	case *MemberPermissionChangeEvent:
+		c.updateMember(event, e.Member, func(m *Member) { m.Permission = e.Current })
+	case *GroupNameChangeEvent:
+		c.updateGroup(event, e.Group.Id, func(g *Group) { g.Name = e.Current })
+	case *BotGroupPermissionChangeEvent:
+		c.updateGroup(event, e.Group.Id, func(g *Group) { g.Permission = e.Current })
+	case *BotJoinGroupEvent:
+		g := newCachedGroup(e.Group, nil)
+		g.refreshing = true
+		c.groups[e.Group.Id] = g
+		go c.refresh(g, false)
+	case *BotLeaveEventActive:
+		delete(c.groups, e.Group.Id)
+	case *BotLeaveEventKick:
+		delete(c.groups, e.Group.Id)
+	case *BotLeaveEventDisband:
+		delete(c.groups, e.Group.Id)
+	case *FriendMessage:
+		if _, ok := c.friends[e.Sender.Id]; ok {
+			c.friends[e.Sender.Id] = e.Sender
+		}
+	case *FriendAddEvent:
+		c.friends[e.Friend.Id] = e.Friend
+	case *FriendDeleteEvent:
+		delete(c.friends, e.Friend.Id)
+	case *FriendNickChangedEvent:
+		if f, ok := c.friends[e.Friend.Id]; ok {
+			f.Nickname = e.To
+			c.friends[e.Friend.Id] = f
+		}
+	}
+}
+
+// withGroup 如果缓存了这个群，则用f更新它。群正在刷新时，还会记下事件，以便刷新完成后重新应用
+func (c *ContactCache) withGroup(event any, group int64, f func(g *cachedGroup)) {
+	if g, ok := c.groups[group]; ok {
+		f(g)
+		if g.refreshing {
+			g.pending = append(g.pending, event)
+		}
+	}
+}
+
+func (c *ContactCache) putMember(event any, m Member) {
+	c.withGroup(event, m.Group.Id, func(g *cachedGroup) { g.members[m.Id] = m })
+}
+
+func (c *ContactCache) removeMember(event any, m Member) {
+	c.withGroup(event, m.Group.Id, func(g *cachedGroup) { delete(g.members, m.Id) })
+}
+
+func (c *ContactCache) updateMember(event any, member Member, update func(m *Member)) {
+	c.withGroup(event, member.Group.Id, func(g *cachedGroup) {
+		m, ok := g.members[member.Id]
+		if !ok {
+			m = member
+		}
+		update(&m)
+		g.members[member.Id] = m
+	})
+}
+
+// updateGroup 更新群的信息，包括每个群成员中的群信息
+func (c *ContactCache) updateGroup(event any, group int64, update func(g *Group)) {
+	c.withGroup(event, group, func(g *cachedGroup) {
+		update(&g.group)
+		for id, m := range g.members {
+			update(&m.Group)
+			g.members[id] = m
+		}
+	})
+}
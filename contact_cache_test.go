@@ -0,0 +1,111 @@
+package miraihttp
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestContactCache(t *testing.T) {
+	var nilCache *ContactCache
+	_, ok := nilCache.Member(1, 2)
+	assert.False(t, ok)
+
+	group := Group{Id: 1, Name: "g", Permission: PermMember}
+	c := &ContactCache{friends: map[int64]Friend{}, groups: map[int64]*cachedGroup{
+		1: newCachedGroup(group, []*Member{{Id: 2, MemberName: "a", Permission: PermMember, Group: group}}),
+	}}
+	c.handleEvent(&MemberCardChangeEvent{Origin: "a", Current: "b", Member: Member{Id: 2, Group: group}})
+	c.handleEvent(&MemberPermissionChangeEvent{Current: PermAdministrator, Member: Member{Id: 2, Group: group}})
+	m, ok := c.Member(1, 2)
+	assert.True(t, ok)
+	assert.Equal(t, "b", m.MemberName)
+	assert.Equal(t, PermAdministrator, m.Permission)
+
+	c.handleEvent(&MemberJoinEvent{Member: Member{Id: 3, Group: group}})
+	assert.Len(t, c.Members(1), 2)
+	c.handleEvent(&MemberLeaveEventQuit{Member: Member{Id: 3, Group: group}})
+	assert.Len(t, c.Members(1), 1)
+
+	c.handleEvent(&GroupNameChangeEvent{Current: "h", Group: group})
+	g, _ := c.Group(1)
+	assert.Equal(t, "h", g.Name)
+	m, _ = c.Member(1, 2)
+	assert.Equal(t, "h", m.Group.Name)
+
+	c.handleEvent(&BotGroupPermissionChangeEvent{Current: PermAdministrator, Group: group})
+	g, _ = c.Group(1)
+	assert.Equal(t, PermAdministrator, g.Permission)
+	m, _ = c.Member(1, 2)
+	assert.Equal(t, PermAdministrator, m.Group.Permission)
+
+	c.handleEvent(&BotLeaveEventKick{Group: group})
+	_, ok = c.Group(1)
+	assert.False(t, ok)
+
+	c.handleEvent(&FriendAddEvent{Friend: Friend{Id: 5, Nickname: "f"}})
+	c.handleEvent(&FriendNickChangedEvent{Friend: Friend{Id: 5}, From: "f", To: "e"})
+	f, ok := c.Friend(5)
+	assert.True(t, ok)
+	assert.Equal(t, "e", f.Nickname)
+	c.handleEvent(&FriendDeleteEvent{Friend: Friend{Id: 5}})
+	assert.Empty(t, c.Friends())
+}
+
+func TestContactCacheRefresh(t *testing.T) {
+	group1, group4 := Group{Id: 1, Name: "g"}, Group{Id: 4, Name: "j"}
+	members := map[int64][]*Member{
+		1: {{Id: 2, MemberName: "a", Group: group1}, {Id: 3, MemberName: "b", Group: group1}},
+		4: {{Id: 2, MemberName: "a", Group: group4}},
+	}
+	release := make(chan struct{})
+	s, b := newTestBot(t, func(req *testRequest) any {
+		switch req.Command {
+		case "groupList":
+			return []Group{group1}
+		case "memberList", "latestMemberList":
+			<-release
+			return members[req.Content.Get("target").Int()]
+		}
+		return []any{}
+	})
+	// 等到第n个command请求发出后，应用event，再让请求返回
+	during := func(command string, n int, event any) {
+		assert.Eventually(t, func() bool { return len(s.Requests(command)) == n }, time.Second, time.Millisecond)
+		b.Cache().handleEvent(event)
+		release <- struct{}{}
+	}
+
+	done := make(chan error)
+	go func() { done <- b.EnableContactCache(time.Hour) }()
+	during("memberList", 1, &MemberJoinEvent{Member: Member{Id: 5, Group: group1}})
+	require.Nil(t, <-done)
+	c := b.Cache()
+	assert.Len(t, c.Members(1), 3)
+
+	// 过期后刷新，刷新期间的事件不会丢失
+	c.lock.Lock()
+	c.groups[1].updateTime = time.Now().Add(-2 * time.Hour)
+	c.lock.Unlock()
+	assert.Len(t, c.Members(1), 3)
+	during("latestMemberList", 1, &MemberLeaveEventQuit{Member: Member{Id: 2, Group: group1}})
+	assert.Eventually(t, func() bool {
+		_, ok := c.Member(1, 2)
+		return !ok && len(c.Members(1)) == 1
+	}, time.Second, time.Millisecond)
+	m, _ := c.Member(1, 3)
+	assert.Equal(t, "b", m.MemberName)
+
+	// 加入新群后拉取成员列表
+	c.handleEvent(&BotJoinGroupEvent{Group: group4})
+	g, ok := c.Group(4)
+	assert.True(t, ok)
+	assert.Equal(t, "j", g.Name)
+	during("memberList", 2, &MemberCardChangeEvent{Current: "c", Member: Member{Id: 2, Group: group4}})
+	assert.Eventually(t, func() bool {
+		m, ok := c.Member(4, 2)
+		return ok && m.MemberName == "c"
+	}, time.Second, time.Millisecond)
+	assert.Len(t, c.Members(4), 1)
+}
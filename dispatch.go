@@ -0,0 +1,96 @@
+package miraihttp
+
+import (
+	"context"
+	"errors"
+	"github.com/tidwall/gjson"
+	"hash/fnv"
+	"strconv"
+)
+
+// keyedDispatcher 按键分组的事件处理器，键相同的事件总是由同一个协程按顺序处理
+type keyedDispatcher struct {
+	key    func(event any) string
+	queues []*eventQueue
+}
+
+func newKeyedDispatcher(b *Bot, workers int, key func(event any) string) *keyedDispatcher {
+	if workers <= 0 {
+		workers = 1
+	}
+	d := &keyedDispatcher{key: key, queues: make([]*eventQueue, workers)}
+	for i := range d.queues {
+		d.queues[i] = newEventQueue(b)
+	}
+	return d
+}
+
+func (d *keyedDispatcher) start() {
+	for _, q := range d.queues {
+		q.startWorker()
+	}
+}
+
+func (d *keyedDispatcher) put(key string, f func(ctx context.Context)) {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(key))
+	d.queues[h.Sum32()%uint32(len(d.queues))].Put(f)
+}
+
+// SetKeyedDispatch 设置按键分组的处理方式：键相同的事件按收到的顺序依次处理，键不同的事件由workers个协程并行处理。
+// 调用者只需要关心不同的键之间的并发问题。每个协程的队列容量和策略取自 SetDispatchOption 。
+//
+// key为nil时按群号或好友QQ号分组，与群或好友无关的事件的键为空串。应当在注册监听之前调用。
+//
+// 只能调用一次，再次调用会返回错误，原来的设置不变。
+func (b *Bot) SetKeyedDispatch(workers int, key func(event any) string) error {
+	d := newKeyedDispatcher(b, workers, key)
+	if !b.keyed.CompareAndSwap(nil, d) {
+		return errors.New("keyed dispatch is already set")
+	}
+	d.start()
+	return nil
+}
+
+// dispatch 按照 Bot 的处理方式处理事件
+func (b *Bot) dispatch(messageType string, data gjson.Result, m any, f func(ctx context.Context)) {
+	if d := b.keyed.Load(); d != nil {
+		var key string
+		if d.key != nil {
+			key = d.key(m)
+		} else {
+			key = defaultDispatchKey(messageType, data)
+		}
+		d.put(key, f)
+		return
+	}
+	b.run(f)
+}
+
+// defaultDispatchKey 从原始数据中找出事件所属的群或好友
+func defaultDispatchKey(messageType string, data gjson.Result) string {
+	groupKey := func(id int64) string { return "group:" + strconv.FormatInt(id, 10) }
+	friendKey := func(id int64) string { return "friend:" + strconv.FormatInt(id, 10) }
+	switch messageType {
+	case "GroupSyncMessage":
+		return groupKey(data.Get("subject.id").Int())
+	case "FriendSyncMessage", "StrangerSyncMessage":
+		return friendKey(data.Get("subject.id").Int())
+	case "NudgeEvent":
+		if data.Get("subject.kind").String() == string(KindGroup) {
+			return groupKey(data.Get("subject.id").Int())
+		}
+		return friendKey(data.Get("subject.id").Int())
+	}
+	for _, path := range []string{"sender.group.id", "subject.group.id", "group.id", "member.group.id", "operator.group.id", "groupId"} {
+		if id := data.Get(path).Int(); id != 0 {
+			return groupKey(id)
+		}
+	}
+	for _, path := range []string{"sender.id", "fromId", "authorId"} {
+		if id := data.Get(path).Int(); id != 0 {
+			return friendKey(id)
+		}
+	}
+	return ""
+}
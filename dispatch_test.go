@@ -0,0 +1,43 @@
+package miraihttp
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/tidwall/gjson"
+	"sync"
+	"testing"
+)
+
+func TestDefaultDispatchKey(t *testing.T) {
+	assert.Equal(t, "group:2", defaultDispatchKey("GroupMessage", gjson.Parse(`{"sender":{"id":1,"group":{"id":2}}}`)))
+	assert.Equal(t, "friend:1", defaultDispatchKey("FriendMessage", gjson.Parse(`{"sender":{"id":1}}`)))
+	assert.Equal(t, "group:3", defaultDispatchKey("MemberJoinEvent", gjson.Parse(`{"member":{"id":1,"group":{"id":3}}}`)))
+	assert.Equal(t, "group:4", defaultDispatchKey("GroupSyncMessage", gjson.Parse(`{"subject":{"id":4}}`)))
+	assert.Equal(t, "friend:5", defaultDispatchKey("NudgeEvent", gjson.Parse(`{"subject":{"id":5,"kind":"Friend"}}`)))
+	assert.Equal(t, "", defaultDispatchKey("Unknown", gjson.Parse(`{}`)))
+}
+
+func TestKeyedDispatch(t *testing.T) {
+	b := newBot(0)
+	assert.Nil(t, b.SetKeyedDispatch(4, func(event any) string { return event.(string) }))
+	assert.NotNil(t, b.SetKeyedDispatch(2, nil))
+	var lock sync.Mutex
+	var wg sync.WaitGroup
+	result := make(map[string][]int)
+	for i := 0; i < 100; i++ {
+		key := []string{"a", "b", "c"}[i%3]
+		wg.Add(1)
+		b.dispatch("", gjson.Result{}, key, func(context.Context) {
+			defer wg.Done()
+			lock.Lock()
+			defer lock.Unlock()
+			result[key] = append(result[key], i)
+		})
+	}
+	wg.Wait()
+	for _, list := range result {
+		for i := 1; i < len(list); i++ {
+			assert.Less(t, list[i-1], list[i])
+		}
+	}
+}
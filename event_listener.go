@@ -19,6 +19,10 @@ func init() {
 	decoder["BotLeaveEventDisband"] = parseEvent[BotLeaveEventDisband]
 	decoder["GroupRecallEvent"] = parseEvent[GroupRecallEvent]
 	decoder["FriendRecallEvent"] = parseEvent[FriendRecallEvent]
+	decoder["FriendInputStatusChangedEvent"] = parseEvent[FriendInputStatusChangedEvent]
+	decoder["FriendNickChangedEvent"] = parseEvent[FriendNickChangedEvent]
+	decoder["FriendAddEvent"] = parseEvent[FriendAddEvent]
+	decoder["FriendDeleteEvent"] = parseEvent[FriendDeleteEvent]
 	decoder["NudgeEvent"] = parseEvent[NudgeEvent]
 	decoder["GroupNameChangeEvent"] = parseEvent[GroupNameChangeEvent]
 	decoder["GroupEntranceAnnouncementChangeEvent"] = parseEvent[GroupEntranceAnnouncementChangeEvent]
@@ -102,7 +106,8 @@ func (b *Bot) ListenBotLeaveEventActive(l func(message *BotLeaveEventActive) boo
 
 // BotLeaveEventKick Bot被踢出一个群
 type BotLeaveEventKick struct {
-	Group Group `json:"group"`
+	Group    Group   `json:"group"`
+	Operator *Member `json:"operator"` // 操作人，可能为空
 }
 
 // ListenBotLeaveEventKick 监听Bot被踢出一个群
@@ -128,6 +133,8 @@ type GroupRecallEvent struct {
 	Time      int64  `json:"time"`      // 原消息发送时间
 	Group     Group  `json:"group"`     // 消息撤回所在的群
 	Operator  Member `json:"operator"`  // 撤回消息的操作人，当null时为bot操作
+
+	Origin MessageChain `json:"-"` // 原消息的内容，只有设置了 MessageStore 并且记录过这条消息时才有
 }
 
 // ListenGroupRecallEvent 监听群消息撤回
@@ -141,6 +148,8 @@ type FriendRecallEvent struct {
 	MessageId int64 `json:"messageId"` // 原消息messageId
 	Time      int64 `json:"time"`      // 原消息发送时间
 	Operator  int64 `json:"operator"`  // 好友QQ号或BotQQ号
+
+	Origin MessageChain `json:"-"` // 原消息的内容，只有设置了 MessageStore 并且记录过这条消息时才有
 }
 
 // ListenFriendRecallEvent 监听好友消息撤回
@@ -148,6 +157,50 @@ func (b *Bot) ListenFriendRecallEvent(l func(message *FriendRecallEvent) bool) {
 	listen(b, "FriendRecallEvent", l)
 }
 
+// FriendInputStatusChangedEvent 好友输入状态改变
+type FriendInputStatusChangedEvent struct {
+	Friend    Friend `json:"friend"`
+	Inputting bool   `json:"inputting"` // 当前输出状态是否正在输入
+}
+
+// ListenFriendInputStatusChangedEvent 监听好友输入状态改变
+func (b *Bot) ListenFriendInputStatusChangedEvent(l func(message *FriendInputStatusChangedEvent) bool) {
+	listen(b, "FriendInputStatusChangedEvent", l)
+}
+
+// FriendNickChangedEvent 好友昵称改变
+type FriendNickChangedEvent struct {
+	Friend Friend `json:"friend"`
+	From   string `json:"from"` // 原昵称
+	To     string `json:"to"`   // 新昵称
+}
+
+// ListenFriendNickChangedEvent 监听好友昵称改变
+func (b *Bot) ListenFriendNickChangedEvent(l func(message *FriendNickChangedEvent) bool) {
+	listen(b, "FriendNickChangedEvent", l)
+}
+
+// FriendAddEvent 添加好友
+type FriendAddEvent struct {
+	Friend   Friend `json:"friend"`
+	Stranger bool   `json:"stranger"` // 是否是因为陌生人会话而添加的好友
+}
+
+// ListenFriendAddEvent 监听添加好友
+func (b *Bot) ListenFriendAddEvent(l func(message *FriendAddEvent) bool) {
+	listen(b, "FriendAddEvent", l)
+}
+
+// FriendDeleteEvent 删除好友
+type FriendDeleteEvent struct {
+	Friend Friend `json:"friend"`
+}
+
+// ListenFriendDeleteEvent 监听删除好友
+func (b *Bot) ListenFriendDeleteEvent(l func(message *FriendDeleteEvent) bool) {
+	listen(b, "FriendDeleteEvent", l)
+}
+
 // NudgeEvent 戳一戳事件
 type NudgeEvent struct {
 	FromId  int64 `json:"fromId"` // 动作发出者的QQ号
@@ -0,0 +1,354 @@
+package miraihttp
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// QueuePolicy 事件队列满了之后的处理策略
+type QueuePolicy int
+
+const (
+	QueuePolicyDropNewest QueuePolicy = iota // 丢弃新的事件，这是默认的策略
+	QueuePolicyDropOldest                    // 丢弃队列中最早的事件
+	QueuePolicyBlock                         // 阻塞读取，直到队列有空位。阻塞期间也无法收到请求的返回，请求可能会超时
+)
+
+// DispatchOption 事件处理的配置
+type DispatchOption struct {
+	// Workers 并发方式启动时处理事件的协程数，为0表示不限制，即每个事件启动一个新协程。
+	// 单线程方式启动或者调用了 Bot.SetKeyedDispatch 时不使用这个值。
+	// 协程池在第一次设置了这个值时启动，之后不能再修改。
+	Workers int
+
+	QueueSize int         // 每个事件队列的容量，为0表示不限
+	Policy    QueuePolicy // 队列满了之后的处理策略
+
+	// HandlerTimeout 单个监听函数的执行超时，超时后不再等待它，当作它返回了true，继续执行后续的监听函数和后续的事件，为0表示不限。
+	//
+	// 注意：超时的监听函数并不会被中止，它会在另一个协程中继续执行，与之后的监听函数同时运行。
+	// 因此单线程方式或 Bot.SetKeyedDispatch 下“同一个队列中的事件按顺序依次处理”的保证对超时的监听函数不再成立，
+	// 它访问的数据需要自行加锁。设置了这个值时，监听函数总是在单独的协程中执行。
+	HandlerTimeout time.Duration
+}
+
+// EventStats 事件处理的统计数据
+type EventStats struct {
+	Queued    int64 // 当前在队列中等待处理的事件数
+	Dropped   int64 // 因为队列满了而被丢弃的事件总数
+	Processed int64 // 已经处理完的事件总数
+	TimedOut  int64 // 执行超时的监听函数总数
+	Running   int64 // 当前正在处理的事件数
+	Waiting   int64 // 当前正在 Bot.WaitNext 中等待的协程数
+	Parked    int64 // 正在处理、但监听函数正在 Bot.WaitNext 中等待的事件数，它们不占用处理事件的协程
+}
+
+type eventStats struct {
+	queued, dropped, processed, timedOut, running, waiting, parked atomic.Int64
+}
+
+// SetDispatchOption 设置事件处理的配置，应当在注册监听之前调用。
+// 协程池启动后再修改 Workers 会返回错误，此时其它配置也不会生效
+func (b *Bot) SetDispatchOption(opt DispatchOption) error {
+	if b.eventChan == nil {
+		if pool := b.pool.Load(); pool != nil {
+			if opt.Workers != pool.workers {
+				return fmt.Errorf("cannot change workers from %d to %d after the worker pool is started", pool.workers, opt.Workers)
+			}
+		} else if opt.Workers > 0 {
+			q := newEventQueue(b)
+			q.workers = opt.Workers
+			if !b.pool.CompareAndSwap(nil, q) {
+				// 同时有别的调用启动了协程池
+				return b.SetDispatchOption(opt)
+			}
+			for i := 0; i < opt.Workers; i++ {
+				q.startWorker()
+			}
+		}
+	}
+	b.dispatchOption.Store(&opt)
+	return nil
+}
+
+// EventStats 获取事件处理的统计数据
+func (b *Bot) EventStats() EventStats {
+	return EventStats{
+		Queued:    b.stats.queued.Load(),
+		Dropped:   b.stats.dropped.Load(),
+		Processed: b.stats.processed.Load(),
+		TimedOut:  b.stats.timedOut.Load(),
+		Running:   b.stats.running.Load(),
+		Waiting:   b.stats.waiting.Load(),
+		Parked:    b.stats.parked.Load(),
+	}
+}
+
+func (b *Bot) getDispatchOption() DispatchOption {
+	if opt := b.dispatchOption.Load(); opt != nil {
+		return *opt
+	}
+	return DispatchOption{}
+}
+
+// runHandler 执行一个监听函数，如果设置了超时，则超时后不再等待它，当作返回了true。超时用 Bot 的 Clock 计时。
+// 监听函数panic时会调用 reportPanic ，并当作返回了false。
+// 如果设置了 Tracer ，会以ctx中的span为父span创建监听函数的span，超时和panic会记录到这个span中，
+// 包含这个span的ctx只传给这一次调用的监听函数。没有设置超时时，ctx中还有这次调用的 handlerCall
+func (b *Bot) runHandler(ctx context.Context, h *listenHandler, m any) bool {
+	ctx, span := b.startSpan(ctx, "handler", func() []Attribute {
+		return []Attribute{{AttrEventType, h.info.EventType}, {AttrHandlerSite, h.info.Site}, {AttrHandlerIndex, int64(h.info.Index)}}
+	})
+	call := func() bool {
+		defer span.End()
+		return b.safeCall(ctx, h, m, span)
+	}
+	timeout := b.getDispatchOption().HandlerTimeout
+	if timeout <= 0 {
+		if r, ok := ctx.Value(workerRunKey{}).(*workerRun); ok {
+			c := &handlerCall{r: r}
+			ctx = context.WithValue(ctx, handlerCallKey{}, c)
+			defer c.finish()
+		}
+		return call()
+	}
+	ch := make(chan bool, 1)
+	go func() {
+		ch <- call()
+	}()
+	timeoutCh := make(chan struct{})
+	timer := b.Clock().AfterFunc(timeout, func() { close(timeoutCh) })
+	defer timer.Stop()
+	select {
+	case ret := <-ch:
+		return ret
+	case <-timeoutCh:
+		b.stats.timedOut.Add(1)
+		span.RecordError(fmt.Errorf("handler timeout after %s", timeout))
+		slog.Warn("handler timeout", "timeout", timeout, "event", m, "site", h.info.Site)
+		return true
+	}
+}
+
+func (b *Bot) safeCall(ctx context.Context, h *listenHandler, m any, span Span) (ret bool) {
+	start := time.Now()
+	defer func() {
+		r := recover()
+		if r != nil {
+			b.reportPanic(m, h.info, r, debug.Stack())
+			span.RecordError(panicError(r))
+			ret = false
+		}
+		b.getMetrics().HandlerDone(h.info.EventType, time.Since(start), r != nil)
+	}()
+	return h.f(ctx, m)
+}
+
+// eventQueue 有容量限制的事件队列，容量和策略取自 Bot 的 DispatchOption
+type eventQueue struct {
+	b        *Bot
+	workers  int // 协程池的协程数，其它队列为0
+	lock     sync.Mutex
+	notEmpty *sync.Cond
+	notFull  *sync.Cond
+	items    []func(ctx context.Context) // ctx中有处理它的 workerRun
+}
+
+func newEventQueue(b *Bot) *eventQueue {
+	q := &eventQueue{b: b}
+	q.notEmpty = sync.NewCond(&q.lock)
+	q.notFull = sync.NewCond(&q.lock)
+	return q
+}
+
+// Put 放入一个事件，队列满了时按照策略处理
+func (q *eventQueue) Put(f func(ctx context.Context)) {
+	opt := q.b.getDispatchOption()
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if opt.QueueSize > 0 {
+		for len(q.items) >= opt.QueueSize {
+			switch opt.Policy {
+			case QueuePolicyDropNewest:
+				q.b.stats.dropped.Add(1)
+				slog.Warn("event queue is full, dropping newest event")
+				return
+			case QueuePolicyDropOldest:
+				q.items[0] = nil
+				q.items = q.items[1:]
+				q.b.stats.queued.Add(-1)
+				q.b.stats.dropped.Add(1)
+				slog.Warn("event queue is full, dropping oldest event")
+			default:
+				q.notFull.Wait()
+			}
+		}
+	}
+	q.items = append(q.items, f)
+	q.b.stats.queued.Add(1)
+	q.notEmpty.Signal()
+}
+
+// Take 取出一个事件，队列为空时阻塞
+func (q *eventQueue) Take() func(ctx context.Context) {
+	return q.take(false)
+}
+
+// take 取出一个事件，running表示是否要计入正在处理的事件数。
+// 先增加正在处理的事件数再减少队列中的事件数，这样不会出现两者都为0但事件还没处理完的瞬间
+func (q *eventQueue) take(running bool) func(ctx context.Context) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	for len(q.items) == 0 {
+		q.notEmpty.Wait()
+	}
+	f := q.items[0]
+	q.items[0] = nil
+	q.items = q.items[1:]
+	if running {
+		q.b.stats.running.Add(1)
+	}
+	q.b.stats.queued.Add(-1)
+	q.notFull.Signal()
+	return f
+}
+
+// Len 队列中的事件数
+func (q *eventQueue) Len() int {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	return len(q.items)
+}
+
+// startWorker 启动一个处理这个队列的协程
+func (q *eventQueue) startWorker() {
+	w := &worker{q: q}
+	w.cond = sync.NewCond(&w.lock)
+	go w.loop()
+}
+
+// worker 处理队列的协程，同一时间只有持有slot的协程能执行事件。
+//
+// 监听函数在 Bot.WaitNext 中等待时会交出slot，并启动一个新的协程代替自己继续处理队列，
+// 等待结束后优先拿回slot，继续执行完这个事件后退出。这样等待期间队列中的其它事件也能被处理，
+// 而同一个队列中的事件仍然不会同时执行
+type worker struct {
+	q        *eventQueue
+	lock     sync.Mutex
+	cond     *sync.Cond
+	busy     bool // 是否有协程持有slot
+	resuming int  // 等待结束、正在等slot的协程数
+}
+
+// workerRun 正在某个协程中处理事件的 worker ，通过传给事件的ctx传递给 Bot.runHandler
+type workerRun struct {
+	w      *worker
+	parked atomic.Bool // 是否已经有别的协程代替这个协程处理队列
+}
+
+type workerRunKey struct{}
+
+func (w *worker) loop() {
+	r := &workerRun{w: w}
+	ctx := context.WithValue(context.Background(), workerRunKey{}, r)
+	for {
+		f := w.q.take(true)
+		w.acquire(false)
+		f(ctx)
+		w.release()
+		w.q.b.stats.processed.Add(1)
+		w.q.b.stats.running.Add(-1)
+		if r.parked.Load() {
+			return
+		}
+	}
+}
+
+// acquire 获取slot，resume为true表示是等待结束的协程，优先于处理新事件的协程
+func (w *worker) acquire(resume bool) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if resume {
+		w.resuming++
+		defer func() { w.resuming-- }()
+	}
+	for w.busy || (!resume && w.resuming > 0) {
+		w.cond.Wait()
+	}
+	w.busy = true
+}
+
+func (w *worker) release() {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	w.busy = false
+	w.cond.Broadcast()
+}
+
+// park 在开始等待时调用，交出slot，必要时启动一个新的协程代替当前协程处理队列
+func (r *workerRun) park() {
+	r.w.release()
+	if r.parked.CompareAndSwap(false, true) {
+		go r.w.loop()
+	}
+}
+
+// unpark 在等待结束时调用，拿回slot
+func (r *workerRun) unpark() {
+	r.w.acquire(true)
+}
+
+// handlerCall 在处理事件的协程中执行的一次监听函数调用，放在传给监听函数的ctx中，
+// Bot.WaitNext 通过它找到要交出slot的 workerRun 。
+// 监听函数自己启动的协程也可以用这个ctx等待，多个等待同时进行时只交出和拿回一次slot
+type handlerCall struct {
+	r       *workerRun
+	lock    sync.Mutex
+	waiting int  // 正在等待的次数
+	done    bool // 监听函数是否已经返回
+}
+
+type handlerCallKey struct{}
+
+// park 开始等待，监听函数已经返回时不做任何事并返回false
+func (c *handlerCall) park() bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.done {
+		return false
+	}
+	if c.waiting == 0 {
+		c.r.park()
+	}
+	c.waiting++
+	return true
+}
+
+// unpark 结束一次由 park 开始的等待
+func (c *handlerCall) unpark() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.done {
+		return
+	}
+	c.waiting--
+	if c.waiting == 0 {
+		c.r.unpark()
+	}
+}
+
+// finish 在监听函数返回时调用，如果它启动的协程还在等待，则先拿回slot再继续处理事件
+func (c *handlerCall) finish() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.done = true
+	if c.waiting > 0 {
+		c.waiting = 0
+		c.r.unpark()
+	}
+}
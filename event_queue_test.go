@@ -0,0 +1,64 @@
+package miraihttp
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestEventQueuePolicy(t *testing.T) {
+	b := newBot(0)
+	assert.Nil(t, b.SetDispatchOption(DispatchOption{QueueSize: 2, Policy: QueuePolicyDropOldest}))
+	q := newEventQueue(b)
+	var order []int
+	for i := 0; i < 3; i++ {
+		q.Put(func(context.Context) { order = append(order, i) })
+	}
+	assert.Equal(t, 2, q.Len())
+	q.Take()(context.Background())
+	q.Take()(context.Background())
+	assert.Equal(t, []int{1, 2}, order)
+
+	assert.Nil(t, b.SetDispatchOption(DispatchOption{QueueSize: 1}))
+	q.Put(func(context.Context) { order = append(order, 3) })
+	q.Put(func(context.Context) { order = append(order, 4) })
+	q.Take()(context.Background())
+	assert.Equal(t, []int{1, 2, 3}, order)
+	assert.Equal(t, EventStats{Dropped: 2}, b.EventStats())
+}
+
+func TestDispatchOptionWorkers(t *testing.T) {
+	b := newBot(0)
+	assert.Nil(t, b.SetDispatchOption(DispatchOption{Workers: 2}))
+	assert.Nil(t, b.SetDispatchOption(DispatchOption{Workers: 2, QueueSize: 10}))
+	assert.NotNil(t, b.SetDispatchOption(DispatchOption{Workers: 3, QueueSize: 20}))
+	assert.Equal(t, 10, b.getDispatchOption().QueueSize)
+	done := make(chan struct{})
+	b.Run(func() { close(done) })
+	<-done
+}
+
+func TestHandlerTimeout(t *testing.T) {
+	b := newBot(0)
+	assert.Nil(t, b.SetDispatchOption(DispatchOption{HandlerTimeout: 10 * time.Millisecond}))
+	release := make(chan struct{})
+	assert.True(t, b.runHandler(context.Background(), &listenHandler{f: func(context.Context, any) bool { <-release; return false }}, nil))
+	close(release)
+	assert.False(t, b.runHandler(context.Background(), &listenHandler{f: func(context.Context, any) bool { return false }}, nil))
+	assert.Equal(t, int64(1), b.EventStats().TimedOut)
+}
+
+func TestPanicHandler(t *testing.T) {
+	b := newBot(0)
+	var info HandlerInfo
+	var recovered any
+	b.OnPanic(func(event any, handler HandlerInfo, r any, stack []byte) {
+		info, recovered = handler, r
+	})
+	b.ListenGroupMessage(func(*GroupMessage) bool { panic("boom") })
+	assert.False(t, b.runHandler(context.Background(), b.handler["GroupMessage"][0], &GroupMessage{}))
+	assert.Equal(t, "boom", recovered)
+	assert.Equal(t, "GroupMessage", info.EventType)
+	assert.Contains(t, info.Site, "event_queue_test.go")
+}
@@ -0,0 +1,125 @@
+package miraihttp
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func readFixture(t *testing.T, dir, name string) []byte {
+	buf, err := os.ReadFile(filepath.Join("testdata", "fixtures", dir, name+".json"))
+	require.NoError(t, err, "missing fixture for %s", name)
+	return buf
+}
+
+// jsonEqual 比较原始的json和重新编码后的json：原始json中的每个字段都要有相同的值，null等同于零值；
+// 重新编码后多出来的字段只能是零值
+func jsonEqual(path string, origin, encoded any) error {
+	if origin == nil {
+		if !isZeroJSON(encoded) {
+			return fmt.Errorf("%s: expected null, got %v", path, encoded)
+		}
+		return nil
+	}
+	switch o := origin.(type) {
+	case map[string]any:
+		e, _ := encoded.(map[string]any)
+		if e == nil && encoded != nil {
+			return fmt.Errorf("%s: expected object, got %v", path, encoded)
+		}
+		for k, v := range o {
+			if err := jsonEqual(path+"."+k, v, e[k]); err != nil {
+				return err
+			}
+		}
+		for k, v := range e {
+			if _, ok := o[k]; !ok && !isZeroJSON(v) {
+				return fmt.Errorf("%s.%s: unexpected field %v", path, k, v)
+			}
+		}
+	case []any:
+		e, _ := encoded.([]any)
+		if len(o) != len(e) {
+			return fmt.Errorf("%s: expected %d elements, got %d", path, len(o), len(e))
+		}
+		for i := range o {
+			if err := jsonEqual(fmt.Sprintf("%s[%d]", path, i), o[i], e[i]); err != nil {
+				return err
+			}
+		}
+	default:
+		if encoded == nil && isZeroJSON(origin) {
+			return nil
+		}
+		if !reflect.DeepEqual(origin, encoded) {
+			return fmt.Errorf("%s: expected %v, got %v", path, origin, encoded)
+		}
+	}
+	return nil
+}
+
+// isZeroJSON 是否是null、零值、空数组，或者所有字段都是零值的对象
+func isZeroJSON(v any) bool {
+	switch v := v.(type) {
+	case nil:
+		return true
+	case map[string]any:
+		for _, e := range v {
+			if !isZeroJSON(e) {
+				return false
+			}
+		}
+		return true
+	case []any:
+		return len(v) == 0
+	default:
+		return reflect.ValueOf(v).IsZero()
+	}
+}
+
+func assertRoundTrip(t *testing.T, raw []byte, decoded any, dropType bool) {
+	var origin, encoded map[string]any
+	require.NoError(t, json.Unmarshal(raw, &origin))
+	if dropType {
+		delete(origin, "type")
+	}
+	buf, err := json.Marshal(decoded)
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(buf, &encoded))
+	assert.NoError(t, jsonEqual("$", origin, encoded))
+}
+
+func TestDecoderFixtures(t *testing.T) {
+	for messageType, p := range decoder {
+		t.Run(messageType, func(t *testing.T) {
+			raw := readFixture(t, "events", messageType)
+			data := gjson.ParseBytes(raw)
+			require.Equal(t, messageType, data.Get("type").String())
+			m := p(data)
+			require.NotNil(t, m)
+			assertRoundTrip(t, raw, m, true)
+		})
+	}
+}
+
+func TestSingleMessageFixtures(t *testing.T) {
+	for messageType := range singleMessageBuilder {
+		t.Run(messageType, func(t *testing.T) {
+			raw := readFixture(t, "messages", messageType)
+			var chain MessageChain
+			require.NoError(t, json.Unmarshal([]byte("["+string(raw)+"]"), &chain))
+			require.Len(t, chain, 1)
+			assertRoundTrip(t, raw, chain[0], false)
+			// 清空Type后能够重新填上
+			reflect.ValueOf(chain[0]).Elem().FieldByName("Type").SetString("")
+			buildMessageChain(chain)
+			assertRoundTrip(t, raw, chain[0], false)
+		})
+	}
+}
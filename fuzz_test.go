@@ -0,0 +1,96 @@
+package miraihttp
+
+import (
+	"encoding/json"
+	"github.com/tidwall/gjson"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// addFixtureSeeds 把所有的fixture加入fuzz的语料，wrap用于把fixture包装成需要的格式
+func addFixtureSeeds(f *testing.F, wrap func(raw []byte) []byte) {
+	for _, dir := range []string{"events", "messages"} {
+		files, err := filepath.Glob(filepath.Join("testdata", "fixtures", dir, "*.json"))
+		if err != nil {
+			f.Fatal(err)
+		}
+		for _, file := range files {
+			raw, err := os.ReadFile(file)
+			if err != nil {
+				f.Fatal(err)
+			}
+			f.Add(wrap(raw))
+		}
+	}
+}
+
+// useChain 调用消息链的各种方法，检查不会panic
+func useChain(c MessageChain) {
+	buildMessageChain(c)
+	_ = c.String()
+	_ = c.PlainText()
+	_ = c.MiraiCode()
+	_, _ = json.Marshal(c)
+	_ = MessageLength(c)
+	_ = SplitMessageChain(c, 16)
+}
+
+func quietLog(f *testing.F) {
+	logger := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	f.Cleanup(func() { slog.SetDefault(logger) })
+}
+
+func FuzzParseMessageChain(f *testing.F) {
+	quietLog(f)
+	addFixtureSeeds(f, func(raw []byte) []byte { return []byte("[" + string(raw) + "]") })
+	f.Add([]byte(`[null, 1, "a", {"type":"Quote","origin":[{"type":"Forward","nodeList":[null]}]}]`))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		if !gjson.ValidBytes(data) {
+			return
+		}
+		useChain(parseMessageChain(gjson.ParseBytes(data).Array()))
+	})
+}
+
+func FuzzMessageChainUnmarshalJSON(f *testing.F) {
+	quietLog(f)
+	addFixtureSeeds(f, func(raw []byte) []byte { return []byte("[" + string(raw) + "]") })
+	f.Add([]byte(`null`))
+	f.Add([]byte(`{"type":"Plain"}`))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var c MessageChain
+		if err := json.Unmarshal(data, &c); err == nil {
+			useChain(c)
+		}
+	})
+}
+
+func FuzzHandleFrame(f *testing.F) {
+	quietLog(f)
+	addFixtureSeeds(f, func(raw []byte) []byte { return []byte(`{"syncId":"-1","data":` + string(raw) + `}`) })
+	f.Add([]byte(`{"syncId":"","data":{"code":1,"msg":"Auth Key错误"}}`))
+	f.Add([]byte(`{"syncId":"1","data":{"code":0}}`))
+	f.Add([]byte(`{"syncId":"-1","data":{"type":"GroupMessage","sender":null,"messageChain":null}}`))
+	b := newBot(0)
+	b.eventChan = newEventQueue(b)
+	b.eventChan.startWorker()
+	for messageType := range decoder {
+		listen(b, messageType, func(m any) bool {
+			useChain(messageChainOf(m))
+			return true
+		})
+	}
+	b.SetMessageStore(NewMemoryMessageStore(16))
+	log := slog.Default()
+	f.Fuzz(func(t *testing.T, data []byte) {
+		b.handleFrame(log, data)
+		// 等待监听函数执行完
+		done := make(chan struct{})
+		b.Run(func() { close(done) })
+		<-done
+	})
+}
@@ -3,7 +3,6 @@ module github.com/CuteReimu/mirai-sdk-http
 go 1.22
 
 require (
-	github.com/CuteReimu/goutil v0.0.0-20240422034935-940ce604f878
 	github.com/gorilla/websocket v1.5.1
 	github.com/stretchr/testify v1.9.0
 	github.com/tidwall/gjson v1.17.1
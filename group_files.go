@@ -0,0 +1,416 @@
+package miraihttp
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+	"time"
+)
+
+// DefaultFileListPageSize 分页获取群文件列表时默认每页的大小
+const DefaultFileListPageSize = 100
+
+// GroupFiles 群文件管理，用"/"分隔的路径来操作群文件，根目录是"/"。
+// 群文件允许重名，按路径查找时使用第一个名字相同的文件
+type GroupFiles struct {
+	b     *Bot
+	group int64
+
+	DownloadOption DownloadOption // 下载文件时使用的选项
+	PageSize       int            // 分页获取文件列表时每页的大小，为0时使用 DefaultFileListPageSize
+}
+
+// GroupFiles 获取一个群的群文件管理
+func (b *Bot) GroupFiles(group int64) *GroupFiles {
+	return &GroupFiles{b: b, group: group}
+}
+
+// isDir 是否是文件夹，旧版本的mirai-api-http只有拼写错误的 IsDictionary 字段
+func (f *FileInfo) isDir() bool {
+	return f.IsDirectory || f.IsDictionary
+}
+
+func (g *GroupFiles) root() *FileInfo {
+	return &FileInfo{Path: "/", Contact: Group{Id: g.group}, IsDirectory: true, IsDictionary: true}
+}
+
+// list 获取文件夹下的所有文件，自动翻页
+func (g *GroupFiles) list(id string) ([]*FileInfo, error) {
+	size := g.PageSize
+	if size <= 0 {
+		size = DefaultFileListPageSize
+	}
+	var ret []*FileInfo
+	for offset := 0; ; offset += size {
+		page, err := g.b.GetFileList(FileListParam{FileLocation: g.location(id), Offset: offset, Size: size})
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, page...)
+		if len(page) < size {
+			return ret, nil
+		}
+	}
+}
+
+// location 这个群中id对应的文件或文件夹
+func (g *GroupFiles) location(id string) FileLocation {
+	return FileLocation{Id: id, Target: g.group}
+}
+
+func splitFilePath(p string) []string {
+	p = path.Clean("/" + p)
+	if p == "/" {
+		return nil
+	}
+	return strings.Split(p[1:], "/")
+}
+
+// Stat 按路径查找文件或文件夹，找不到时返回的错误满足 errors.Is(err, fs.ErrNotExist)
+func (g *GroupFiles) Stat(p string) (*FileInfo, error) {
+	cur := g.root()
+	for _, name := range splitFilePath(p) {
+		if !cur.isDir() {
+			return nil, &fs.PathError{Op: "stat", Path: p, Err: fs.ErrNotExist}
+		}
+		files, err := g.list(cur.Id)
+		if err != nil {
+			return nil, &fs.PathError{Op: "stat", Path: p, Err: err}
+		}
+		cur = findFile(files, name)
+		if cur == nil {
+			return nil, &fs.PathError{Op: "stat", Path: p, Err: fs.ErrNotExist}
+		}
+	}
+	return cur, nil
+}
+
+func findFile(files []*FileInfo, name string) *FileInfo {
+	for _, f := range files {
+		if f.Name == name {
+			return f
+		}
+	}
+	return nil
+}
+
+// ReadDir 获取文件夹下的所有文件和文件夹
+func (g *GroupFiles) ReadDir(p string) ([]*FileInfo, error) {
+	dir, err := g.Stat(p)
+	if err != nil {
+		return nil, err
+	}
+	if !dir.isDir() {
+		return nil, &fs.PathError{Op: "readdir", Path: p, Err: errors.New("not a directory")}
+	}
+	files, err := g.list(dir.Id)
+	if err != nil {
+		return nil, &fs.PathError{Op: "readdir", Path: p, Err: err}
+	}
+	return files, nil
+}
+
+// Walk 遍历root下的所有文件和文件夹，用法同 fs.WalkDir 。
+// fn返回 fs.SkipDir 时跳过当前文件夹（对文件返回时跳过所在文件夹的剩余内容），返回 fs.SkipAll 时结束遍历
+func (g *GroupFiles) Walk(root string, fn func(p string, info *FileInfo, err error) error) error {
+	info, err := g.Stat(root)
+	if err != nil {
+		err = fn(root, nil, err)
+	} else {
+		err = g.walk(root, info, fn)
+	}
+	if errors.Is(err, fs.SkipDir) || errors.Is(err, fs.SkipAll) {
+		return nil
+	}
+	return err
+}
+
+func (g *GroupFiles) walk(p string, info *FileInfo, fn func(p string, info *FileInfo, err error) error) error {
+	if err := fn(p, info, nil); err != nil || !info.isDir() {
+		if errors.Is(err, fs.SkipDir) && info.isDir() {
+			return nil
+		}
+		return err
+	}
+	files, err := g.list(info.Id)
+	if err != nil {
+		if err = fn(p, info, err); err != nil {
+			if errors.Is(err, fs.SkipDir) {
+				return nil
+			}
+			return err
+		}
+	}
+	for _, f := range files {
+		if err = g.walk(path.Join(p, f.Name), f, fn); err != nil {
+			if errors.Is(err, fs.SkipDir) {
+				return nil
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// MkdirAll 创建文件夹，以及所有不存在的上级文件夹，返回最后一级文件夹的信息
+func (g *GroupFiles) MkdirAll(p string) (*FileInfo, error) {
+	cur := g.root()
+	for _, name := range splitFilePath(p) {
+		files, err := g.list(cur.Id)
+		if err != nil {
+			return nil, &fs.PathError{Op: "mkdir", Path: p, Err: err}
+		}
+		next := findFile(files, name)
+		if next == nil {
+			if next, err = g.b.FileMkdir(FileMkdirParam{FileLocation: g.location(cur.Id), DirectoryName: name}); err != nil {
+				return nil, &fs.PathError{Op: "mkdir", Path: p, Err: err}
+			}
+		} else if !next.isDir() {
+			return nil, &fs.PathError{Op: "mkdir", Path: p, Err: fs.ErrExist}
+		}
+		cur = next
+	}
+	return cur, nil
+}
+
+// statNotRoot 查找文件或文件夹，不允许是根目录
+func (g *GroupFiles) statNotRoot(op, p string) (*FileInfo, error) {
+	if len(splitFilePath(p)) == 0 {
+		return nil, &fs.PathError{Op: op, Path: p, Err: fs.ErrInvalid}
+	}
+	return g.Stat(p)
+}
+
+// Remove 删除文件或文件夹
+func (g *GroupFiles) Remove(p string) error {
+	f, err := g.statNotRoot("remove", p)
+	if err != nil {
+		return err
+	}
+	return g.b.FileDelete(FileDeleteParam{FileLocation: g.location(f.Id)})
+}
+
+// Rename 重命名文件或文件夹，newName是新的文件名，不是路径
+func (g *GroupFiles) Rename(p, newName string) error {
+	if newName == "" || strings.Contains(newName, "/") {
+		return &fs.PathError{Op: "rename", Path: newName, Err: fs.ErrInvalid}
+	}
+	f, err := g.statNotRoot("rename", p)
+	if err != nil {
+		return err
+	}
+	return g.b.FileRename(FileRenameParam{FileLocation: g.location(f.Id), RenameTo: newName})
+}
+
+// Move 把文件移动到dstDir文件夹下
+func (g *GroupFiles) Move(p, dstDir string) error {
+	f, err := g.statNotRoot("move", p)
+	if err != nil {
+		return err
+	}
+	dir, err := g.Stat(dstDir)
+	if err != nil {
+		return err
+	}
+	if !dir.isDir() {
+		return &fs.PathError{Op: "move", Path: dstDir, Err: errors.New("not a directory")}
+	}
+	return g.b.FileMove(FileMoveParam{FileLocation: g.location(f.Id), MoveTo: dir.Id})
+}
+
+// Download 下载文件，会校验sha1和md5
+func (g *GroupFiles) Download(ctx context.Context, p string, w io.Writer) error {
+	f, err := g.statNotRoot("download", p)
+	if err != nil {
+		return err
+	}
+	return g.download(ctx, f, w)
+}
+
+func (g *GroupFiles) download(ctx context.Context, f *FileInfo, w io.Writer) error {
+	if f.isDir() {
+		return &fs.PathError{Op: "download", Path: f.Path, Err: errors.New("is a directory")}
+	}
+	info, err := g.b.GetFileInfo(FileInfoParam{FileLocation: g.location(f.Id), WithDownloadInfo: true})
+	if err != nil {
+		return err
+	}
+	if info.DownloadInfo == nil {
+		return errors.New("no download info")
+	}
+	return info.DownloadInfo.Download(ctx, w, g.DownloadOption)
+}
+
+// FS 返回一个只读的 fs.FS ，可以配合 fs.WalkDir 、 fs.ReadFile 等使用。
+// 路径按照 fs.ValidPath 的规则，不以"/"开头，根目录是"."，读取文件内容时会下载文件
+func (g *GroupFiles) FS() fs.FS {
+	return groupFS{g}
+}
+
+type groupFS struct {
+	g *GroupFiles
+}
+
+func (f groupFS) stat(op, name string) (*FileInfo, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	info, err := f.g.Stat(name)
+	if err != nil {
+		var pe *fs.PathError
+		if errors.As(err, &pe) {
+			err = pe.Err
+		}
+		return nil, &fs.PathError{Op: op, Path: name, Err: err}
+	}
+	return info, nil
+}
+
+func (f groupFS) Open(name string) (fs.File, error) {
+	info, err := f.stat("open", name)
+	if err != nil {
+		return nil, err
+	}
+	return &groupFile{g: f.g, name: name, info: info}, nil
+}
+
+func (f groupFS) Stat(name string) (fs.FileInfo, error) {
+	info, err := f.stat("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	return groupFileStat{info}, nil
+}
+
+func (f groupFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	info, err := f.stat("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	if !info.isDir() {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: errors.New("not a directory")}
+	}
+	files, err := f.g.list(info.Id)
+	if err != nil {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: err}
+	}
+	return dirEntries(files), nil
+}
+
+func dirEntries(files []*FileInfo) []fs.DirEntry {
+	ret := make([]fs.DirEntry, 0, len(files))
+	for _, f := range files {
+		ret = append(ret, groupFileStat{f})
+	}
+	return ret
+}
+
+// groupFileStat 同时实现了 fs.FileInfo 和 fs.DirEntry
+type groupFileStat struct {
+	f *FileInfo
+}
+
+func (s groupFileStat) Name() string {
+	if s.f.Name == "" {
+		return "."
+	}
+	return s.f.Name
+}
+
+func (s groupFileStat) Size() int64 {
+	return s.f.Size
+}
+
+func (s groupFileStat) Mode() fs.FileMode {
+	if s.f.isDir() {
+		return fs.ModeDir | 0555
+	}
+	return 0444
+}
+
+func (s groupFileStat) ModTime() time.Time {
+	return time.Unix(int64(s.f.LastModifyTime), 0)
+}
+
+func (s groupFileStat) IsDir() bool {
+	return s.f.isDir()
+}
+
+// Sys 返回 *FileInfo
+func (s groupFileStat) Sys() any {
+	return s.f
+}
+
+func (s groupFileStat) Type() fs.FileMode {
+	return s.Mode().Type()
+}
+
+func (s groupFileStat) Info() (fs.FileInfo, error) {
+	return s, nil
+}
+
+// groupFile 打开的群文件，读取文件内容时在后台下载，读取文件夹时一次性获取所有文件
+type groupFile struct {
+	g      *GroupFiles
+	name   string
+	info   *FileInfo
+	r      *io.PipeReader
+	cancel context.CancelFunc
+	dir    []fs.DirEntry
+	dirOk  bool
+}
+
+func (f *groupFile) Stat() (fs.FileInfo, error) {
+	return groupFileStat{f.info}, nil
+}
+
+func (f *groupFile) Read(p []byte) (int, error) {
+	if f.info.isDir() {
+		return 0, &fs.PathError{Op: "read", Path: f.name, Err: errors.New("is a directory")}
+	}
+	if f.r == nil {
+		ctx, cancel := context.WithCancel(context.Background())
+		r, w := io.Pipe()
+		f.r, f.cancel = r, cancel
+		go func() {
+			_ = w.CloseWithError(f.g.download(ctx, f.info, w))
+		}()
+	}
+	return f.r.Read(p)
+}
+
+func (f *groupFile) ReadDir(n int) ([]fs.DirEntry, error) {
+	if !f.info.isDir() {
+		return nil, &fs.PathError{Op: "readdir", Path: f.name, Err: errors.New("not a directory")}
+	}
+	if !f.dirOk {
+		files, err := f.g.list(f.info.Id)
+		if err != nil {
+			return nil, &fs.PathError{Op: "readdir", Path: f.name, Err: err}
+		}
+		f.dir, f.dirOk = dirEntries(files), true
+	}
+	if n <= 0 {
+		ret := f.dir
+		f.dir = nil
+		return ret, nil
+	}
+	if len(f.dir) == 0 {
+		return nil, io.EOF
+	}
+	n = min(n, len(f.dir))
+	ret := f.dir[:n:n]
+	f.dir = f.dir[n:]
+	return ret, nil
+}
+
+func (f *groupFile) Close() error {
+	if f.r != nil {
+		f.cancel()
+		return f.r.Close()
+	}
+	return nil
+}
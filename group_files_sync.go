@@ -0,0 +1,442 @@
+package miraihttp
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/tidwall/gjson"
+	"io"
+	"io/fs"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// FileUploader 上传群文件。mirai-api-http的ws接口不支持上传文件，需要另外开启http接口，参见 HttpFileUploader
+type FileUploader interface {
+	// UploadGroupFile 上传文件到群文件的dirId文件夹下，dirId为空串表示根目录
+	UploadGroupFile(ctx context.Context, group int64, dirId, name string, r io.Reader) (*FileInfo, error)
+}
+
+// HttpFileUploader 通过mirai-api-http的http接口上传群文件，需要在配置文件中开启http adapter
+type HttpFileUploader struct {
+	Url       string       // http接口的地址，例如"http://localhost:8080"
+	VerifyKey string       // http接口的verifyKey
+	QQ        int64        // Bot的QQ号
+	Client    *http.Client // 为nil时使用超时为10分钟的默认客户端
+
+	lock       sync.Mutex
+	sessionKey string
+}
+
+func (u *HttpFileUploader) client() *http.Client {
+	if u.Client != nil {
+		return u.Client
+	}
+	return defaultDownloadClient
+}
+
+func (u *HttpFileUploader) postJson(ctx context.Context, api string, body any) (gjson.Result, error) {
+	buf, err := json.Marshal(body)
+	if err != nil {
+		return gjson.Result{}, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.Url+api, bytes.NewReader(buf))
+	if err != nil {
+		return gjson.Result{}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return u.do(req)
+}
+
+func (u *HttpFileUploader) do(req *http.Request) (gjson.Result, error) {
+	resp, err := u.client().Do(req)
+	if err != nil {
+		return gjson.Result{}, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	buf, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return gjson.Result{}, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return gjson.Result{}, fmt.Errorf("http status: %s", resp.Status)
+	}
+	result := gjson.ParseBytes(buf)
+	if code := result.Get("code").Int(); code != 0 {
+		return result, fmt.Errorf("Non-zero code: %d, error message: %s", code, result.Get("msg").String())
+	}
+	return result, nil
+}
+
+// session 获取已经绑定的sessionKey，没有时先认证再绑定
+func (u *HttpFileUploader) session(ctx context.Context, renew bool) (string, error) {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	if u.sessionKey != "" && !renew {
+		return u.sessionKey, nil
+	}
+	result, err := u.postJson(ctx, "/verify", map[string]any{"verifyKey": u.VerifyKey})
+	if err != nil {
+		return "", err
+	}
+	sessionKey := result.Get("session").String()
+	if _, err = u.postJson(ctx, "/bind", map[string]any{"sessionKey": sessionKey, "qq": u.QQ}); err != nil {
+		return "", err
+	}
+	u.sessionKey = sessionKey
+	return sessionKey, nil
+}
+
+// UploadGroupFile 上传文件，文件内容边读边上传，不会全部读到内存里。
+// sessionKey失效时会重新认证一次并重新上传，这需要r实现 io.Seeker ，否则直接返回错误
+func (u *HttpFileUploader) UploadGroupFile(ctx context.Context, group int64, dirId, name string, r io.Reader) (*FileInfo, error) {
+	seeker, canRetry := r.(io.Seeker)
+	var start int64
+	if canRetry {
+		var err error
+		start, err = seeker.Seek(0, io.SeekCurrent)
+		canRetry = err == nil
+	}
+	var result gjson.Result
+	var err error
+	for i := 0; i < 2; i++ {
+		var sessionKey string
+		if sessionKey, err = u.session(ctx, i > 0); err != nil {
+			return nil, err
+		}
+		if i > 0 {
+			if _, err = seeker.Seek(start, io.SeekStart); err != nil {
+				return nil, err
+			}
+		}
+		if result, err = u.upload(ctx, sessionKey, group, dirId, name, r); err == nil {
+			break
+		}
+		// 3-Session失效或不存在，4-Session未认证
+		if code := result.Get("code").Int(); !canRetry || code != 3 && code != 4 {
+			return nil, err
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	info := &FileInfo{}
+	if err = json.Unmarshal([]byte(result.Get("data").Raw), info); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// upload 用multipart上传文件，请求体通过 io.Pipe 在另一个协程中边读r边写入。返回前会等待这个协程结束，之后才能重新读r
+func (u *HttpFileUploader) upload(ctx context.Context, sessionKey string, group int64, dirId, name string, r io.Reader) (gjson.Result, error) {
+	pr, pw := io.Pipe()
+	w := multipart.NewWriter(pw)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_ = pw.CloseWithError(writeUploadForm(w, sessionKey, group, dirId, name, r))
+	}()
+	defer func() {
+		_ = pr.Close()
+		<-done
+	}()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.Url+"/file/upload", pr)
+	if err != nil {
+		return gjson.Result{}, err
+	}
+	req.Header.Set("Content-Type", w.FormDataContentType())
+	return u.do(req)
+}
+
+func writeUploadForm(w *multipart.Writer, sessionKey string, group int64, dirId, name string, r io.Reader) error {
+	for _, field := range [][2]string{{"sessionKey", sessionKey}, {"type", "group"}, {"target", strconv.FormatInt(group, 10)}, {"path", dirId}} {
+		if err := w.WriteField(field[0], field[1]); err != nil {
+			return err
+		}
+	}
+	fw, err := w.CreateFormFile("file", name)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(fw, r); err != nil {
+		return err
+	}
+	return w.Close()
+}
+
+// SyncAction 同步时的操作
+type SyncAction int
+
+const (
+	SyncMkdir  SyncAction = iota // 创建文件夹
+	SyncUpload                   // 上传新文件
+	SyncUpdate                   // 文件有变化，上传新文件后删除旧文件
+	SyncDelete                   // 删除本地没有的文件或文件夹
+)
+
+func (a SyncAction) String() string {
+	switch a {
+	case SyncMkdir:
+		return "mkdir"
+	case SyncUpload:
+		return "upload"
+	case SyncUpdate:
+		return "update"
+	case SyncDelete:
+		return "delete"
+	default:
+		return "unknown"
+	}
+}
+
+// SyncItem 同步时的一项操作
+type SyncItem struct {
+	Action SyncAction
+	Path   string // 群文件中的路径
+	Local  string // 本地文件路径，删除时为空
+	Size   int64  // 文件大小
+	remote *FileInfo
+}
+
+func (i *SyncItem) String() string {
+	if i.Action == SyncUpload || i.Action == SyncUpdate {
+		return fmt.Sprintf("%s %s (%d bytes)", i.Action, i.Path, i.Size)
+	}
+	return i.Action.String() + " " + i.Path
+}
+
+// SyncProgress 同步的进度
+type SyncProgress struct {
+	Item  *SyncItem // 刚刚执行完的操作
+	Done  int       // 已经执行完的操作数，包括这一项
+	Total int       // 总共的操作数
+	Err   error     // 这一项的错误
+}
+
+// SyncOption 同步的配置
+type SyncOption struct {
+	Uploader FileUploader         // 用于上传文件，DryRun 时可以为nil
+	Delete   bool                 // 是否删除群文件中本地没有的文件和文件夹
+	DryRun   bool                 // 只计算需要执行的操作，不实际执行
+	Progress func(p SyncProgress) // 每执行完一项操作后调用，可以为nil
+}
+
+// Sync 把本地文件夹localDir同步到群文件的remoteDir文件夹。按照文件名、大小和MD5比较，上传新增和有变化的文件，
+// 群文件没有MD5时改为比较修改时间。返回需要执行的所有操作。遇到错误时停止，已经执行的操作不会回滚。
+// 群文件中同名的文件和文件夹冲突时，只有开启了 SyncOption.Delete 才会删除后重新上传，否则返回错误
+func (g *GroupFiles) Sync(ctx context.Context, localDir, remoteDir string, opt SyncOption) ([]*SyncItem, error) {
+	remoteDir = path.Clean("/" + remoteDir)
+	items, err := g.syncPlan(localDir, remoteDir, opt.Delete)
+	if err != nil || opt.DryRun {
+		return items, err
+	}
+	if opt.Uploader == nil {
+		for _, item := range items {
+			if item.Action == SyncUpload || item.Action == SyncUpdate {
+				return items, errors.New("file uploader is required")
+			}
+		}
+	}
+	dirIds := make(map[string]string)
+	if len(items) > 0 {
+		dir, err := g.MkdirAll(remoteDir)
+		if err != nil {
+			return items, err
+		}
+		dirIds[remoteDir] = dir.Id
+	}
+	for i, item := range items {
+		if err = ctx.Err(); err != nil {
+			return items, err
+		}
+		err = g.syncItem(ctx, item, dirIds, opt.Uploader)
+		if opt.Progress != nil {
+			opt.Progress(SyncProgress{Item: item, Done: i + 1, Total: len(items), Err: err})
+		}
+		if err != nil {
+			return items, err
+		}
+	}
+	return items, nil
+}
+
+func (g *GroupFiles) syncItem(ctx context.Context, item *SyncItem, dirIds map[string]string, uploader FileUploader) error {
+	switch item.Action {
+	case SyncMkdir:
+		dir, err := g.MkdirAll(item.Path)
+		if err != nil {
+			return err
+		}
+		dirIds[item.Path] = dir.Id
+		return nil
+	case SyncDelete:
+		return g.removeId(item.remote.Id)
+	default:
+		dirPath, name := path.Split(item.Path)
+		dirPath = path.Clean(dirPath)
+		dirId, ok := dirIds[dirPath]
+		if !ok {
+			dir, err := g.Stat(dirPath)
+			if err != nil {
+				return err
+			}
+			dirId, dirIds[dirPath] = dir.Id, dir.Id
+		}
+		f, err := os.Open(item.Local)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = f.Close() }()
+		if _, err = uploader.UploadGroupFile(ctx, g.group, dirId, name, f); err != nil {
+			return err
+		}
+		if item.remote != nil {
+			return g.removeId(item.remote.Id)
+		}
+		return nil
+	}
+}
+
+func (g *GroupFiles) removeId(id string) error {
+	return g.b.FileDelete(FileDeleteParam{FileLocation: g.location(id)})
+}
+
+// syncPlan 比较本地和群文件，计算需要执行的操作，顺序是先删除冲突的文件，再创建文件夹、上传文件，最后删除多余的文件
+func (g *GroupFiles) syncPlan(localDir, remoteDir string, del bool) ([]*SyncItem, error) {
+	remote := make(map[string]*FileInfo)
+	err := g.Walk(remoteDir, func(p string, info *FileInfo, err error) error {
+		if p == remoteDir && errors.Is(err, fs.ErrNotExist) {
+			return fs.SkipAll
+		} else if err != nil {
+			return err
+		}
+		if p != remoteDir {
+			remote[p] = info
+		} else if !info.isDir() {
+			return &fs.PathError{Op: "sync", Path: p, Err: errors.New("not a directory")}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	var conflicts, mkdirs, uploads, deletes []*SyncItem
+	local := make(map[string]bool)
+	deleted := make(map[string]bool)
+	err = filepath.WalkDir(localDir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(localDir, p)
+		if err != nil || rel == "." {
+			return err
+		}
+		remotePath := path.Join(remoteDir, filepath.ToSlash(rel))
+		local[remotePath] = true
+		r := remote[remotePath]
+		if r != nil && r.isDir() != d.IsDir() {
+			if !del {
+				return &fs.PathError{Op: "sync", Path: remotePath, Err: fs.ErrExist}
+			}
+			conflicts = append(conflicts, &SyncItem{Action: SyncDelete, Path: remotePath, remote: r})
+			deleted[remotePath] = true
+			r = nil
+		}
+		if d.IsDir() {
+			if r == nil {
+				mkdirs = append(mkdirs, &SyncItem{Action: SyncMkdir, Path: remotePath})
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if r != nil && r.Size == info.Size() {
+			same, err := sameFile(p, info, r)
+			if err != nil {
+				return err
+			}
+			if same {
+				return nil
+			}
+		}
+		item := &SyncItem{Action: SyncUpload, Path: remotePath, Local: p, Size: info.Size(), remote: r}
+		if r != nil {
+			item.Action = SyncUpdate
+		}
+		uploads = append(uploads, item)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if del {
+		paths := make([]string, 0, len(remote))
+		for p := range remote {
+			paths = append(paths, p)
+		}
+		sort.Strings(paths)
+		for _, p := range paths {
+			if local[p] || deleted[p] || hasDeletedParent(deleted, p, remoteDir) {
+				continue
+			}
+			deleted[p] = true
+			deletes = append(deletes, &SyncItem{Action: SyncDelete, Path: p, remote: remote[p]})
+		}
+	}
+	return append(append(append(conflicts, mkdirs...), uploads...), deletes...), nil
+}
+
+// hasDeletedParent 上级文件夹会被删除时不需要再单独删除
+func hasDeletedParent(deleted map[string]bool, p, root string) bool {
+	for p = path.Dir(p); p != root && p != "/"; p = path.Dir(p) {
+		if deleted[p] {
+			return true
+		}
+	}
+	return false
+}
+
+// sameFile 判断大小相同的本地文件和群文件是否相同。群文件有md5时比较md5，没有时比较修改时间，
+// 本地文件不比群文件新时认为相同，群文件也没有修改时间时认为有变化
+func sameFile(p string, info fs.FileInfo, r *FileInfo) (bool, error) {
+	if r.Md5 != "" {
+		sum, err := fileMd5(p)
+		if err != nil {
+			return false, err
+		}
+		return strings.EqualFold(sum, r.Md5), nil
+	}
+	if r.LastModifyTime > 0 {
+		return info.ModTime().Unix() <= int64(r.LastModifyTime), nil
+	}
+	return false, nil
+}
+
+func fileMd5(name string) (string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = f.Close() }()
+	h := md5.New()
+	if _, err = io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,237 @@
+package miraihttp
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeGroupFiles 在内存中模拟群文件相关的请求，配合 newTestBot 使用
+type fakeGroupFiles struct {
+	lock  sync.Mutex
+	files map[string][]*FileInfo // 文件夹id -> 文件列表
+}
+
+func (s *fakeGroupFiles) handle(req *testRequest) any {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	id := req.Content.Get("id").String()
+	switch req.Command {
+	case "file_list":
+		files := s.files[id]
+		offset, size := int(req.Content.Get("offset").Int()), int(req.Content.Get("size").Int())
+		return files[min(offset, len(files)):min(offset+size, len(files))]
+	case "file_mkdir":
+		dir := &FileInfo{Name: req.Content.Get("directoryName").String(), Id: "d" + strconv.Itoa(len(s.files)), IsDirectory: true}
+		s.files[id] = append(s.files[id], dir)
+		s.files[dir.Id] = nil
+		return dir
+	case "file_delete", "file_rename", "file_move":
+		for parent, files := range s.files {
+			for i, f := range files {
+				if f.Id != id {
+					continue
+				}
+				switch req.Command {
+				case "file_delete":
+					s.files[parent] = append(files[:i:i], files[i+1:]...)
+				case "file_rename":
+					f.Name = req.Content.Get("renameTo").String()
+				case "file_move":
+					s.files[parent] = append(files[:i:i], files[i+1:]...)
+					moveTo := req.Content.Get("moveTo").String()
+					s.files[moveTo] = append(s.files[moveTo], f)
+				}
+				return nil
+			}
+		}
+	}
+	return nil
+}
+
+func TestGroupFiles(t *testing.T) {
+	s := &fakeGroupFiles{files: map[string][]*FileInfo{"": {
+		{Name: "a.txt", Id: "f1", IsFile: true, Size: 3},
+		{Name: "b.txt", Id: "f2", IsFile: true, Size: 4},
+		{Name: "c.txt", Id: "f3", IsFile: true, Size: 5},
+	}}}
+	ts, b := newTestBot(t, s.handle)
+	g := b.GroupFiles(100)
+	g.PageSize = 2
+
+	files, err := g.ReadDir("/")
+	require.NoError(t, err)
+	assert.Len(t, files, 3)
+
+	_, err = g.Stat("/x/y")
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+
+	dir, err := g.MkdirAll("/x/y")
+	require.NoError(t, err)
+	assert.True(t, dir.IsDirectory)
+	again, err := g.MkdirAll("x/y")
+	require.NoError(t, err)
+	assert.Equal(t, dir.Id, again.Id)
+	_, err = g.MkdirAll("/a.txt/z")
+	assert.ErrorIs(t, err, fs.ErrExist)
+
+	require.NoError(t, g.Move("/a.txt", "/x/y"))
+	require.NoError(t, g.Rename("/x/y/a.txt", "d.txt"))
+	require.NoError(t, g.Remove("/b.txt"))
+	assert.Error(t, g.Remove("/"))
+	assert.Len(t, ts.Requests("file_delete"), 1)
+	assert.Equal(t, int64(100), ts.Requests("file_delete")[0].Content.Get("target").Int())
+
+	var walked []string
+	require.NoError(t, g.Walk("/", func(p string, info *FileInfo, err error) error {
+		walked = append(walked, p)
+		return err
+	}))
+	assert.Equal(t, []string{"/", "/c.txt", "/x", "/x/y", "/x/y/d.txt"}, walked)
+
+	var fsWalked []string
+	require.NoError(t, fs.WalkDir(g.FS(), ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			fsWalked = append(fsWalked, p)
+		}
+		return nil
+	}))
+	assert.Equal(t, []string{"c.txt", "x/y/d.txt"}, fsWalked)
+
+	info, err := fs.Stat(g.FS(), "c.txt")
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), info.Size())
+	_, err = g.FS().Open("/c.txt")
+	assert.ErrorIs(t, err, fs.ErrInvalid)
+}
+
+type fakeUploader struct {
+	s *fakeGroupFiles
+}
+
+func (u fakeUploader) UploadGroupFile(_ context.Context, _ int64, dirId, name string, r io.Reader) (*FileInfo, error) {
+	buf, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	sum := md5.Sum(buf)
+	u.s.lock.Lock()
+	defer u.s.lock.Unlock()
+	f := &FileInfo{Name: name, Id: "u" + name, IsFile: true, Size: int64(len(buf)), Md5: hex.EncodeToString(sum[:])}
+	u.s.files[dirId] = append(u.s.files[dirId], f)
+	return f, nil
+}
+
+func TestGroupFilesSync(t *testing.T) {
+	same := md5.Sum([]byte("same"))
+	s := &fakeGroupFiles{files: map[string][]*FileInfo{
+		"": {{Name: "course", Id: "d1", IsDirectory: true}},
+		"d1": {
+			{Name: "same.txt", Id: "f1", IsFile: true, Size: 4, Md5: hex.EncodeToString(same[:])},
+			{Name: "changed.txt", Id: "f2", IsFile: true, Size: 3, Md5: "00"},
+			{Name: "extra.txt", Id: "f3", IsFile: true, Size: 1},
+			// 没有md5时比较修改时间，也没有修改时间时认为有变化
+			{Name: "newer.txt", Id: "f4", IsFile: true, Size: 4, LastModifyTime: int(time.Now().Add(time.Hour).Unix())},
+			{Name: "older.txt", Id: "f5", IsFile: true, Size: 3, LastModifyTime: 1},
+			{Name: "unknown.txt", Id: "f6", IsFile: true, Size: 5},
+		},
+	}}
+	ts, b := newTestBot(t, s.handle)
+	g := b.GroupFiles(100)
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "same.txt"), []byte("same"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "changed.txt"), []byte("new"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "newer.txt"), []byte("abcd"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "older.txt"), []byte("abc"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "unknown.txt"), []byte("abcde"), 0644))
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "week1"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "week1", "a.pdf"), []byte("pdf"), 0644))
+
+	items, err := g.Sync(context.Background(), dir, "/course", SyncOption{Delete: true, DryRun: true})
+	require.NoError(t, err)
+	var plan []string
+	for _, item := range items {
+		plan = append(plan, item.String())
+	}
+	assert.Equal(t, []string{
+		"mkdir /course/week1",
+		"update /course/changed.txt (3 bytes)",
+		"update /course/older.txt (3 bytes)",
+		"update /course/unknown.txt (5 bytes)",
+		"upload /course/week1/a.pdf (3 bytes)",
+		"delete /course/extra.txt",
+	}, plan)
+	assert.Empty(t, ts.Requests("file_delete"))
+
+	var progress []int
+	_, err = g.Sync(context.Background(), dir, "/course", SyncOption{Delete: true, Uploader: fakeUploader{s},
+		Progress: func(p SyncProgress) {
+			assert.NoError(t, p.Err)
+			progress = append(progress, p.Done)
+		}})
+	require.NoError(t, err)
+	assert.Equal(t, []int{1, 2, 3, 4, 5, 6}, progress)
+
+	items, err = g.Sync(context.Background(), dir, "/course", SyncOption{Delete: true, DryRun: true})
+	require.NoError(t, err)
+	assert.Empty(t, items)
+}
+
+func TestHttpFileUploader(t *testing.T) {
+	var lock sync.Mutex
+	var sessions, uploaded []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+		switch r.URL.Path {
+		case "/verify":
+			sessions = append(sessions, "s"+strconv.Itoa(len(sessions)))
+			_, _ = fmt.Fprintf(w, `{"code":0,"session":"%s"}`, sessions[len(sessions)-1])
+		case "/bind":
+			_, _ = w.Write([]byte(`{"code":0}`))
+		case "/file/upload":
+			f, h, err := r.FormFile("file")
+			require.NoError(t, err)
+			buf, _ := io.ReadAll(f)
+			// 第一个session已经失效
+			if r.FormValue("sessionKey") == "s0" {
+				_, _ = w.Write([]byte(`{"code":3,"msg":"session expired"}`))
+				return
+			}
+			uploaded = append(uploaded, h.Filename+":"+string(buf))
+			_, _ = fmt.Fprintf(w, `{"code":0,"data":{"name":"%s","id":"u1","isFile":true,"size":%d}}`, h.Filename, len(buf))
+		}
+	}))
+	defer server.Close()
+
+	u := &HttpFileUploader{Url: server.URL, QQ: 1}
+	info, err := u.UploadGroupFile(context.Background(), 100, "", "a.txt", strings.NewReader("hello"))
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), info.Size)
+	assert.Equal(t, []string{"a.txt:hello"}, uploaded)
+	assert.Len(t, sessions, 2)
+
+	// 不能重新读取的内容在session失效时不重试
+	u = &HttpFileUploader{Url: server.URL, QQ: 1}
+	sessions = nil
+	_, err = u.UploadGroupFile(context.Background(), 100, "", "b.txt", io.MultiReader(strings.NewReader("x")))
+	assert.Error(t, err)
+}
@@ -0,0 +1,160 @@
+// Package fakemirai 实现mirai-api-http的ws协议中与业务无关的部分：握手、收发请求和推送。
+// miraitest.Server 和miraihttp包内的测试都基于它，这样两者的协议行为不会不一致
+package fakemirai
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/gorilla/websocket"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ws连接的通道，与 miraihttp.WsChannelAll 等相同
+var channels = map[string]bool{"all": true, "message": true, "event": true}
+
+// Handler 处理Bot发来的一条请求，返回响应中的syncId和data字段
+type Handler func(buf []byte) (syncId string, data any)
+
+// Server 模拟mirai-api-http的ws服务端
+type Server struct {
+	verifyKey string
+	qq        int64
+	handle    Handler
+	onConnect func()
+
+	server *httptest.Server
+	lock   sync.Mutex
+	conns  map[*conn]struct{}
+}
+
+type conn struct {
+	c    *websocket.Conn
+	lock sync.Mutex
+}
+
+func (c *conn) write(syncId string, data any) error {
+	buf, err := json.Marshal(map[string]any{"syncId": syncId, "data": data})
+	if err != nil {
+		return err
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.c.WriteMessage(websocket.TextMessage, buf)
+}
+
+// New 启动一个服务端，用完后需要调用 Close 。onConnect在每个Bot连接上之后调用，可以为nil
+func New(verifyKey string, qq int64, handle Handler, onConnect func()) *Server {
+	s := &Server{verifyKey: verifyKey, qq: qq, handle: handle, onConnect: onConnect, conns: make(map[*conn]struct{})}
+	s.server = httptest.NewServer(http.HandlerFunc(s.serve))
+	return s
+}
+
+// Host 服务端的地址
+func (s *Server) Host() string {
+	u, _ := url.Parse(s.server.URL)
+	return u.Hostname()
+}
+
+// Port 服务端的端口
+func (s *Server) Port() int {
+	u, _ := url.Parse(s.server.URL)
+	port, _ := strconv.Atoi(u.Port())
+	return port
+}
+
+// Connected 已经连接上的Bot数
+func (s *Server) Connected() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return len(s.conns)
+}
+
+// Close 断开所有连接并关闭服务端
+func (s *Server) Close() {
+	s.lock.Lock()
+	for c := range s.conns {
+		_ = c.c.Close()
+	}
+	s.lock.Unlock()
+	s.server.Close()
+}
+
+func fail(code int, msg string) map[string]any {
+	return map[string]any{"code": code, "msg": msg}
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	if !channels[strings.TrimPrefix(r.URL.Path, "/")] {
+		http.NotFound(w, r)
+		return
+	}
+	wc, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	c := &conn{c: wc}
+	defer func() { _ = wc.Close() }()
+	query := r.URL.Query()
+	if query.Get("verifyKey") != s.verifyKey {
+		_ = c.write("", fail(1, "Auth Key错误"))
+		return
+	}
+	if query.Get("qq") != strconv.FormatInt(s.qq, 10) {
+		_ = c.write("", fail(2, "指定的Bot不存在"))
+		return
+	}
+	// 先记录连接再完成握手，这样Bot连接成功后就一定能收到推送
+	s.lock.Lock()
+	s.conns[c] = struct{}{}
+	s.lock.Unlock()
+	defer func() {
+		s.lock.Lock()
+		delete(s.conns, c)
+		s.lock.Unlock()
+	}()
+	if err = c.write("", map[string]any{"code": 0, "session": "fakemirai"}); err != nil {
+		return
+	}
+	if s.onConnect != nil {
+		s.onConnect()
+	}
+	for {
+		_, buf, err := wc.ReadMessage()
+		if err != nil {
+			return
+		}
+		syncId, data := s.handle(buf)
+		if err = c.write(syncId, data); err != nil {
+			return
+		}
+	}
+}
+
+// Push 向所有连接的Bot推送一条消息或事件，data是ws消息中的data字段
+func (s *Server) Push(data any) error {
+	s.lock.Lock()
+	conns := make([]*conn, 0, len(s.conns))
+	for c := range s.conns {
+		conns = append(conns, c)
+	}
+	s.lock.Unlock()
+	if len(conns) == 0 {
+		return errors.New("no bot connected")
+	}
+	for _, c := range conns {
+		if err := c.write("-1", data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// BadRequest 请求不是合法的json时的返回
+func BadRequest(err error) (string, any) {
+	return "", fail(400, "invalid json: "+err.Error())
+}
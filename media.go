@@ -0,0 +1,196 @@
+package miraihttp
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+)
+
+const (
+	DefaultMaxImageSize int64 = 30 << 20 // 默认的图片最大字节数
+	DefaultMaxVoiceSize int64 = 10 << 20 // 默认的语音最大字节数
+)
+
+// MediaOption 读取图片和语音时的选项，零值表示使用默认值
+type MediaOption struct {
+	MaxImageSize int64 // 图片的最大字节数，为0时使用 DefaultMaxImageSize
+	MaxVoiceSize int64 // 语音的最大字节数，为0时使用 DefaultMaxVoiceSize
+}
+
+// mediaOption 取opt中的第一个，并填上默认值
+func mediaOption(opt []MediaOption) MediaOption {
+	var o MediaOption
+	if len(opt) > 0 {
+		o = opt[0]
+	}
+	if o.MaxImageSize <= 0 {
+		o.MaxImageSize = DefaultMaxImageSize
+	}
+	if o.MaxVoiceSize <= 0 {
+		o.MaxVoiceSize = DefaultMaxVoiceSize
+	}
+	return o
+}
+
+// ImageFromFile 读取Bot所在机器上的本地图片，并转为Base64编码的 Image ，与 Image.Path 不同，不要求图片在mirai所在的机器上
+func ImageFromFile(path string, opt ...MediaOption) (*Image, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+	return ImageFromReader(f, opt...)
+}
+
+// ImageFromReader 读取图片，并转为Base64编码的 Image
+func ImageFromReader(r io.Reader, opt ...MediaOption) (*Image, error) {
+	data, err := readLimited(r, mediaOption(opt).MaxImageSize)
+	if err != nil {
+		return nil, err
+	}
+	return ImageFromBytes(data, opt...)
+}
+
+// ImageFromBytes 把图片转为Base64编码的 Image ，会检查图片格式和大小
+func ImageFromBytes(data []byte, opt ...MediaOption) (*Image, error) {
+	if limit := mediaOption(opt).MaxImageSize; int64(len(data)) > limit {
+		return nil, fmt.Errorf("image size %d exceeds limit %d", len(data), limit)
+	}
+	if contentType := http.DetectContentType(data); !strings.HasPrefix(contentType, "image/") {
+		return nil, fmt.Errorf("unsupported image content type: %s", contentType)
+	}
+	return &Image{Type: "Image", Base64: base64.StdEncoding.EncodeToString(data)}, nil
+}
+
+// VoiceFromFile 读取Bot所在机器上的本地语音，并转为Base64编码的 Voice ，仅支持amr和silk格式
+func VoiceFromFile(path string, opt ...MediaOption) (*Voice, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+	return VoiceFromReader(f, opt...)
+}
+
+// VoiceFromReader 读取语音，并转为Base64编码的 Voice ，仅支持amr和silk格式
+func VoiceFromReader(r io.Reader, opt ...MediaOption) (*Voice, error) {
+	data, err := readLimited(r, mediaOption(opt).MaxVoiceSize)
+	if err != nil {
+		return nil, err
+	}
+	return VoiceFromBytes(data, opt...)
+}
+
+// VoiceFromBytes 把语音转为Base64编码的 Voice ，仅支持amr和silk格式，会检查语音格式和大小
+func VoiceFromBytes(data []byte, opt ...MediaOption) (*Voice, error) {
+	if limit := mediaOption(opt).MaxVoiceSize; int64(len(data)) > limit {
+		return nil, fmt.Errorf("voice size %d exceeds limit %d", len(data), limit)
+	}
+	if !bytes.HasPrefix(data, []byte("#!AMR")) && !bytes.HasPrefix(data, []byte("#!SILK_V3")) &&
+		!bytes.HasPrefix(data, []byte("\x02#!SILK_V3")) {
+		return nil, errors.New("unsupported voice format, only amr and silk are supported")
+	}
+	return &Voice{Type: "Voice", Base64: base64.StdEncoding.EncodeToString(data)}, nil
+}
+
+// readLimited 读取全部内容，超过limit字节时返回错误
+func readLimited(r io.Reader, limit int64) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limit {
+		return nil, fmt.Errorf("media size exceeds limit %d", limit)
+	}
+	return data, nil
+}
+
+// ImageCache 按图片内容的MD5缓存imageId，再次发送相同的图片时可以直接使用imageId，避免重复上传。
+// 用 Bot.SetImageCache 设置后，发送Base64编码的图片成功时会自动记录mirai分配的imageId
+type ImageCache struct {
+	m sync.Map
+}
+
+// NewImageCache 新建一个图片缓存
+func NewImageCache() *ImageCache {
+	return &ImageCache{}
+}
+
+// Image 如果缓存中有这张图片，则返回只包含imageId的 Image ，否则同 ImageFromBytes
+func (c *ImageCache) Image(data []byte, opt ...MediaOption) (*Image, error) {
+	if imageId, ok := c.Load(data); ok {
+		return &Image{Type: "Image", ImageId: imageId}, nil
+	}
+	return ImageFromBytes(data, opt...)
+}
+
+// Load 查找这张图片对应的imageId
+func (c *ImageCache) Load(data []byte) (string, bool) {
+	imageId, ok := c.m.Load(md5Hex(data))
+	if !ok {
+		return "", false
+	}
+	return imageId.(string), true
+}
+
+// Store 记录这张图片对应的imageId，一般在图片发送成功后调用
+func (c *ImageCache) Store(data []byte, imageId string) {
+	c.m.Store(md5Hex(data), imageId)
+}
+
+func md5Hex(data []byte) string {
+	sum := md5.Sum(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// SetImageCache 设置图片缓存，为nil表示不使用。
+// 设置后，每次发送了Base64编码的图片，都会通过 Bot.MessageFromId 获取mirai分配的imageId并记录到缓存中，
+// 因此需要mirai-api-http开启消息缓存
+func (b *Bot) SetImageCache(c *ImageCache) {
+	b.imageCache.Store(c)
+}
+
+// learnImageIds 发送消息成功后，记录其中Base64编码的图片的imageId
+func (b *Bot) learnImageIds(target, messageId int64, messageChain MessageChain) {
+	c := b.imageCache.Load()
+	if c == nil {
+		return
+	}
+	md5s := make(map[string]bool)
+	for _, m := range messageChain {
+		if image, ok := m.(*Image); ok && image.ImageId == "" && image.Base64 != "" {
+			if data, err := base64.StdEncoding.DecodeString(image.Base64); err == nil {
+				md5s[md5Hex(data)] = true
+			}
+		}
+	}
+	if len(md5s) == 0 {
+		return
+	}
+	go func() {
+		message, err := b.messageFromServer(messageId, target)
+		if err != nil {
+			slog.Warn("cannot get sent message for image cache", "messageId", messageId, "error", err)
+			return
+		}
+		for _, m := range messageChainOf(message) {
+			image, ok := m.(*Image)
+			if !ok {
+				continue
+			}
+			// imageId中包含了图片的MD5，用它来找到对应的图片
+			if sum, err := ImageIdToMd5(image.ImageId); err == nil && md5s[sum] {
+				c.m.Store(sum, image.ImageId)
+			}
+		}
+	}()
+}
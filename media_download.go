@@ -0,0 +1,204 @@
+package miraihttp
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultMaxDownloadSize    int64 = 1 << 30                // 默认的下载最大字节数
+	DefaultDownloadRetries          = 3                      // 默认的下载重试次数
+	DefaultDownloadRetryDelay       = 500 * time.Millisecond // 默认的第一次重试前的等待时间
+)
+
+// defaultDownloadClient 默认的下载图片、语音和文件时使用的http客户端
+var defaultDownloadClient = &http.Client{Timeout: 10 * time.Minute}
+
+// DownloadOption 下载图片、语音和文件时的选项，零值表示使用默认值
+type DownloadOption struct {
+	Client     *http.Client  // 使用的http客户端，为nil时使用超时为10分钟的默认客户端
+	MaxSize    int64         // 最大字节数，为0时使用 DefaultMaxDownloadSize
+	Retries    int           // 失败时的重试次数，只有在还没有写入任何内容时才会重试。为0时使用 DefaultDownloadRetries ，小于0表示不重试
+	RetryDelay time.Duration // 第一次重试前的等待时间，之后每次重试前等待的时间翻倍。为0时使用 DefaultDownloadRetryDelay
+}
+
+// downloadOption 取opt中的第一个，并填上默认值
+func downloadOption(opt []DownloadOption) DownloadOption {
+	var o DownloadOption
+	if len(opt) > 0 {
+		o = opt[0]
+	}
+	if o.Client == nil {
+		o.Client = defaultDownloadClient
+	}
+	if o.MaxSize <= 0 {
+		o.MaxSize = DefaultMaxDownloadSize
+	}
+	if o.Retries == 0 {
+		o.Retries = DefaultDownloadRetries
+	} else if o.Retries < 0 {
+		o.Retries = 0
+	}
+	if o.RetryDelay <= 0 {
+		o.RetryDelay = DefaultDownloadRetryDelay
+	}
+	return o
+}
+
+// Download 下载收到的图片
+func (m *Image) Download(ctx context.Context, w io.Writer, opt ...DownloadOption) error {
+	return download(ctx, m.Url, w, nil, downloadOption(opt))
+}
+
+// Download 下载收到的闪照
+func (m *FlashImage) Download(ctx context.Context, w io.Writer, opt ...DownloadOption) error {
+	return download(ctx, m.Url, w, nil, downloadOption(opt))
+}
+
+// Download 下载收到的语音
+func (m *Voice) Download(ctx context.Context, w io.Writer, opt ...DownloadOption) error {
+	return download(ctx, m.Url, w, nil, downloadOption(opt))
+}
+
+// Download 下载群文件，下载完成后会校验sha1和md5。校验失败时返回错误，但内容已经写入了w，调用者应当丢弃它
+func (m *FileDownloadInfo) Download(ctx context.Context, w io.Writer, opt ...DownloadOption) error {
+	var checks []*digestCheck
+	if m.Sha1 != "" {
+		checks = append(checks, &digestCheck{name: "sha1", expected: m.Sha1, hash: sha1.New()})
+	}
+	if m.Md5 != "" {
+		checks = append(checks, &digestCheck{name: "md5", expected: m.Md5, hash: md5.New()})
+	}
+	return download(ctx, m.Url, w, checks, downloadOption(opt))
+}
+
+type digestCheck struct {
+	name     string
+	expected string
+	hash     hash.Hash
+}
+
+func (c *digestCheck) check() error {
+	actual := hex.EncodeToString(c.hash.Sum(nil))
+	if !strings.EqualFold(actual, c.expected) {
+		return fmt.Errorf("%s mismatch, expected: %s, actual: %s", c.name, c.expected, actual)
+	}
+	return nil
+}
+
+// countingWriter 记录写入了多少字节，用来判断能否重试
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func download(ctx context.Context, url string, w io.Writer, checks []*digestCheck, opt DownloadOption) error {
+	if url == "" {
+		return errors.New("download url is empty")
+	}
+	log := slog.With("url", url)
+	writers := []io.Writer{w}
+	for _, c := range checks {
+		writers = append(writers, c.hash)
+	}
+	cw := &countingWriter{w: io.MultiWriter(writers...)}
+	var err error
+	delay := opt.RetryDelay
+	for i := 0; ; i++ {
+		if err = downloadOnce(ctx, url, cw, opt); err == nil || cw.n > 0 || ctx.Err() != nil || i >= opt.Retries {
+			break
+		}
+		log.Warn("download failed, retrying", "error", err, "retry", i+1, "delay", delay)
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			err = ctx.Err()
+		case <-timer.C:
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		delay *= 2
+	}
+	if err != nil {
+		log.Error("download failed", "error", err)
+		return err
+	}
+	for _, c := range checks {
+		if err = c.check(); err != nil {
+			log.Error("download integrity check failed", "error", err)
+			return err
+		}
+	}
+	return nil
+}
+
+func downloadOnce(ctx context.Context, url string, w io.Writer, opt DownloadOption) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := opt.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected http status: %s", resp.Status)
+	}
+	if resp.ContentLength > opt.MaxSize {
+		return fmt.Errorf("content length %d exceeds limit %d", resp.ContentLength, opt.MaxSize)
+	}
+	n, err := io.Copy(w, io.LimitReader(resp.Body, opt.MaxSize+1))
+	if err != nil {
+		return err
+	}
+	if n > opt.MaxSize {
+		return fmt.Errorf("download size exceeds limit %d", opt.MaxSize)
+	}
+	if resp.ContentLength >= 0 && n != resp.ContentLength {
+		return fmt.Errorf("unexpected end of body, expected %d bytes, got %d", resp.ContentLength, n)
+	}
+	return nil
+}
+
+var imageIdPattern = regexp.MustCompile(`^\{([0-9A-Fa-f]{8})-([0-9A-Fa-f]{4})-([0-9A-Fa-f]{4})-([0-9A-Fa-f]{4})-([0-9A-Fa-f]{12})}\.\w+$`)
+
+// ImageIdToMd5 从形如 {01E9451B-70ED-EAE3-B37C-101F1EEBF5B5}.jpg 的imageId中解析出图片的MD5（小写十六进制）
+func ImageIdToMd5(imageId string) (string, error) {
+	matches := imageIdPattern.FindStringSubmatch(imageId)
+	if matches == nil {
+		return "", fmt.Errorf("cannot decode md5 from image id: %s", imageId)
+	}
+	return strings.ToLower(strings.Join(matches[1:], "")), nil
+}
+
+// Md5ToImageId 根据图片的MD5和扩展名构造imageId，是 ImageIdToMd5 的逆操作
+func Md5ToImageId(md5Hex, ext string) (string, error) {
+	if len(md5Hex) != 32 {
+		return "", fmt.Errorf("invalid md5: %s", md5Hex)
+	}
+	if _, err := hex.DecodeString(md5Hex); err != nil {
+		return "", fmt.Errorf("invalid md5: %s", md5Hex)
+	}
+	s := strings.ToUpper(md5Hex)
+	return fmt.Sprintf("{%s-%s-%s-%s-%s}.%s", s[:8], s[8:12], s[12:16], s[16:20], s[20:], ext), nil
+}
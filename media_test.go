@@ -0,0 +1,128 @@
+package miraihttp
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestImageFromBytes(t *testing.T) {
+	png := []byte("\x89PNG\r\n\x1a\n0000")
+	image, err := ImageFromBytes(png)
+	assert.Nil(t, err)
+	assert.Equal(t, base64.StdEncoding.EncodeToString(png), image.Base64)
+	_, err = ImageFromBytes([]byte("hello"))
+	assert.NotNil(t, err)
+
+	cache := NewImageCache()
+	cache.Store(png, "{id}.png")
+	image, err = cache.Image(png)
+	assert.Nil(t, err)
+	assert.Equal(t, &Image{Type: "Image", ImageId: "{id}.png"}, image)
+
+	_, err = VoiceFromBytes([]byte("#!SILK_V3xxxx"))
+	assert.Nil(t, err)
+	_, err = VoiceFromBytes([]byte("ID3xxxx"))
+	assert.NotNil(t, err)
+}
+
+func TestMediaOption(t *testing.T) {
+	png := []byte("\x89PNG\r\n\x1a\n0000")
+	_, err := ImageFromBytes(png, MediaOption{MaxImageSize: 4})
+	assert.NotNil(t, err)
+	_, err = ImageFromReader(bytes.NewReader(png), MediaOption{MaxImageSize: 4})
+	assert.NotNil(t, err)
+	_, err = ImageFromReader(bytes.NewReader(png), MediaOption{MaxImageSize: 100})
+	assert.Nil(t, err)
+	_, err = VoiceFromBytes([]byte("#!SILK_V3xxxx"), MediaOption{MaxVoiceSize: 4})
+	assert.NotNil(t, err)
+}
+
+func TestImageCacheLearn(t *testing.T) {
+	png := []byte("\x89PNG\r\n\x1a\n0000")
+	imageId, err := Md5ToImageId(md5Hex(png), "png")
+	assert.Nil(t, err)
+	_, b := newTestBot(t, func(req *testRequest) any {
+		if req.Command != "messageFromId" {
+			return nil
+		}
+		return map[string]any{"data": map[string]any{
+			"type":         "GroupMessage",
+			"sender":       map[string]any{"id": 1, "group": map[string]any{"id": 100}},
+			"messageChain": []any{map[string]any{"type": "Source", "id": 1}, map[string]any{"type": "Image", "imageId": imageId}},
+		}}
+	})
+	cache := NewImageCache()
+	b.SetImageCache(cache)
+	image, err := cache.Image(png)
+	assert.Nil(t, err)
+	assert.NotEmpty(t, image.Base64)
+	_, err = b.SendGroupMessage(100, 0, MessageChain{image})
+	assert.Nil(t, err)
+	assert.Eventually(t, func() bool {
+		id, ok := cache.Load(png)
+		return ok && id == imageId
+	}, time.Second, time.Millisecond)
+	image, err = cache.Image(png)
+	assert.Nil(t, err)
+	assert.Equal(t, &Image{Type: "Image", ImageId: imageId}, image)
+}
+
+func TestDownload(t *testing.T) {
+	content := []byte("hello world")
+	failures := 1
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failures > 0 {
+			failures--
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		_, _ = w.Write(content)
+	}))
+	defer server.Close()
+
+	var buf bytes.Buffer
+	opt := DownloadOption{RetryDelay: time.Millisecond}
+	assert.Nil(t, (&Image{Url: server.URL}).Download(context.Background(), &buf, opt))
+	assert.Equal(t, content, buf.Bytes())
+
+	failures = 1
+	assert.NotNil(t, (&Image{Url: server.URL}).Download(context.Background(), io.Discard, DownloadOption{Retries: -1}))
+	assert.Nil(t, (&Image{Url: server.URL}).Download(context.Background(), io.Discard, DownloadOption{MaxSize: int64(len(content))}))
+	assert.NotNil(t, (&Image{Url: server.URL}).Download(context.Background(), io.Discard, DownloadOption{MaxSize: 1}))
+
+	failures = 100
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err := (&Image{Url: server.URL}).Download(ctx, io.Discard, DownloadOption{RetryDelay: time.Minute})
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), 10*time.Second)
+	failures = 0
+
+	sum := md5.Sum(content)
+	info := &FileDownloadInfo{Url: server.URL, Md5: hex.EncodeToString(sum[:])}
+	buf.Reset()
+	assert.Nil(t, info.Download(context.Background(), &buf))
+	info.Sha1 = "0000"
+	assert.NotNil(t, info.Download(context.Background(), io.Discard))
+}
+
+func TestImageIdToMd5(t *testing.T) {
+	md5Hex, err := ImageIdToMd5("{01E9451B-70ED-EAE3-B37C-101F1EEBF5B5}.jpg")
+	assert.Nil(t, err)
+	assert.Equal(t, "01e9451b70edeae3b37c101f1eebf5b5", md5Hex)
+	imageId, err := Md5ToImageId(md5Hex, "jpg")
+	assert.Nil(t, err)
+	assert.Equal(t, "{01E9451B-70ED-EAE3-B37C-101F1EEBF5B5}.jpg", imageId)
+	_, err = ImageIdToMd5("/f8f1ab55-bf8e-4236-b55e-955848d7069f")
+	assert.NotNil(t, err)
+}
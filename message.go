@@ -16,6 +16,10 @@ func (c *MessageChain) UnmarshalJSON(data []byte) error {
 		return errors.New("invalid json data")
 	}
 	result := gjson.ParseBytes(data)
+	if result.Type == gjson.Null {
+		*c = nil
+		return nil
+	}
 	if !result.IsArray() {
 		return errors.New("result is not array")
 	}
@@ -52,16 +56,19 @@ func (m *Source) String() string {
 
 // Quote 引用回复
 type Quote struct {
-	Type     string `json:"type"`
-	Id       int64  `json:"id"`       // 被引用回复的原消息的messageId
-	GroupId  int64  `json:"groupId"`  // 被引用回复的原消息所接收的群号，当为好友消息时为0
-	SenderId int64  `json:"senderId"` // 被引用回复的原消息的发送者的QQ号
-	TargetId int64  `json:"targetId"` // 被引用回复的原消息的接收者的QQ号（或群号）
-	Origin   []any  `json:"origin"`   // 被引用回复的原消息的消息链对象
+	Type     string       `json:"type"`
+	Id       int64        `json:"id"`       // 被引用回复的原消息的messageId
+	GroupId  int64        `json:"groupId"`  // 被引用回复的原消息所接收的群号，当为好友消息时为0
+	SenderId int64        `json:"senderId"` // 被引用回复的原消息的发送者的QQ号
+	TargetId int64        `json:"targetId"` // 被引用回复的原消息的接收者的QQ号（或群号）
+	Origin   MessageChain `json:"origin"`   // 被引用回复的原消息的消息链对象
+
+	fromBuilder bool // 是否由 ChainBuilder 添加，只有这样的引用回复才会在发送时被提取出来
 }
 
 func (m *Quote) FillMessageType() {
 	m.Type = "Quote"
+	buildMessageChain(m.Origin)
 }
 
 func (m *Quote) String() string {
@@ -98,9 +105,10 @@ func (m *AtAll) String() string {
 
 // Face QQ表情
 type Face struct {
-	Type   string `json:"type"`
-	FaceId int32  `json:"faceId,omitempty"` // QQ表情编号，可选，优先高于name
-	Name   string `json:"name,omitempty"`   // QQ表情拼音，可选
+	Type      string `json:"type"`
+	FaceId    int32  `json:"faceId,omitempty"`    // QQ表情编号，可选，优先高于name
+	Name      string `json:"name,omitempty"`      // QQ表情拼音，可选
+	SuperFace bool   `json:"superFace,omitempty"` // 是否是超级表情
 }
 
 func (m *Face) FillMessageType() {
@@ -139,6 +147,14 @@ type Image struct {
 	Url     string `json:"url,omitempty"`     // 图片的URL，发送时可作网络图片的链接；接收时为腾讯图片服务器的链接，可用于图片下载
 	Path    string `json:"path,omitempty"`    // 图片的路径，发送本地图片，路径相对于 JVM 工作路径（默认是当前路径，可通过 -Duser.dir=...指定），也可传入绝对路径。
 	Base64  string `json:"base64,omitempty"`  // 图片的 Base64 编码
+
+	// 以下字段只有接收时才有
+
+	Width     int32  `json:"width,omitempty"`     // 图片宽度
+	Height    int32  `json:"height,omitempty"`    // 图片高度
+	Size      int64  `json:"size,omitempty"`      // 图片大小
+	ImageType string `json:"imageType,omitempty"` // 图片类型，例如"PNG"
+	IsEmoji   bool   `json:"isEmoji,omitempty"`   // 是否是表情
 }
 
 func (m *Image) FillMessageType() {
@@ -156,6 +172,12 @@ type FlashImage struct {
 	Url     string `json:"url,omitempty"`
 	Path    string `json:"path,omitempty"`
 	Base64  string `json:"base64,omitempty"`
+
+	Width     int32  `json:"width,omitempty"`
+	Height    int32  `json:"height,omitempty"`
+	Size      int64  `json:"size,omitempty"`
+	ImageType string `json:"imageType,omitempty"`
+	IsEmoji   bool   `json:"isEmoji,omitempty"`
 }
 
 func (m *FlashImage) FillMessageType() {
@@ -173,7 +195,7 @@ type Voice struct {
 	Url     string `json:"url,omitempty"`     // 语音的URL，发送时可作网络语音的链接；接收时为腾讯语音服务器的链接，可用于语音下载
 	Path    string `json:"path,omitempty"`    // 语音的路径，发送本地语音，路径相对于 JVM 工作路径（默认是当前路径，可通过 -Duser.dir=...指定），也可传入绝对路径。
 	Base64  string `json:"base64,omitempty"`  // 语音的 Base64 编码
-	Length  string `json:"length,omitempty"`  // 返回的语音长度, 发送消息时可以不传
+	Length  int64  `json:"length,omitempty"`  // 返回的语音长度, 发送消息时可以不传
 }
 
 func (m *Voice) FillMessageType() {
@@ -306,35 +328,55 @@ func (m *MusicShare) String() string {
 }
 
 type ForwardMessageNode struct {
-	SenderId     int64  `json:"senderId,omitempty"`     // 消息节点
-	Time         int64  `json:"time,omitempty"`         // 发送时间
-	SenderName   string `json:"senderName,omitempty"`   // 显示名称
-	MessageChain []any  `json:"messageChain,omitempty"` // 消息数组
+	SenderId     int64        `json:"senderId,omitempty"`     // 消息节点
+	Time         int64        `json:"time,omitempty"`         // 发送时间
+	SenderName   string       `json:"senderName,omitempty"`   // 显示名称
+	MessageChain MessageChain `json:"messageChain,omitempty"` // 消息数组，其中可以再嵌套 ForwardMessage
 
 	MessageId int64 `json:"messageId,omitempty"` // 可以只使用消息messageId，从当前对话上下文缓存中读取一条消息作为节点
 
 	// MessageRef 引用缓存中其他对话上下文的消息作为节点
 	//
 	// 参考 https://docs.mirai.mamoe.net/mirai-api-http/api/MessageType.html#forwardmessage
-	MessageRef map[string]any `json:"messageRef,omitempty"`
+	MessageRef *MessageRef `json:"messageRef,omitempty"`
 
 	// (senderId, time, senderName, messageChain), messageId, messageRef 是三种不同构造引用节点的方式，选其中一个/组传参即可
 }
 
+// MessageRef 引用其他对话上下文中的消息
+type MessageRef struct {
+	MessageId int64 `json:"messageId"` // 消息的messageId
+	Target    int64 `json:"target"`    // 消息所在的好友或群
+}
+
+// ForwardDisplay 转发消息的卡片显示文本，值为空表示使用客户端默认值
+type ForwardDisplay struct {
+	Title   string   `json:"title,omitempty"`   // 卡片顶部标题
+	Brief   string   `json:"brief,omitempty"`   // 消息列表显示
+	Source  string   `json:"source,omitempty"`  // 未知
+	Preview []string `json:"preview,omitempty"` // 卡片消息预览，每个元素是一行
+	Summary string   `json:"summary,omitempty"` // 卡片底部摘要
+}
+
 // ForwardMessage 转发消息
 type ForwardMessage struct {
 	Type string `json:"type"`
 
-	// Display 转发消息的卡片显示文本，值为表示使用客户端默认值。发送时可以直接填nil，表示全用默认值。
+	// Display 转发消息的卡片显示文本，发送时可以直接填nil，表示全用默认值。
 	//
 	// 参考 https://docs.mirai.mamoe.net/mirai-api-http/api/MessageType.html#forwardmessage
-	Display map[string]any `json:"display,omitempty"`
+	Display *ForwardDisplay `json:"display,omitempty"`
 
 	NodeList []*ForwardMessageNode `json:"nodeList"` // 消息节点
 }
 
 func (m *ForwardMessage) FillMessageType() {
 	m.Type = "Forward"
+	for _, node := range m.NodeList {
+		if node != nil {
+			buildMessageChain(node.MessageChain)
+		}
+	}
 }
 
 func (m *ForwardMessage) String() string {
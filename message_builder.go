@@ -0,0 +1,191 @@
+package miraihttp
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// ChainBuilder 消息链构造器，相邻的文字消息会自动合并
+//
+//	chain, err := NewChain().Text("hi ").At(qq).Face("微笑").ImageURL(u).Build()
+type ChainBuilder struct {
+	chain MessageChain
+	err   error
+}
+
+// NewChain 新建一个消息链构造器
+func NewChain() *ChainBuilder {
+	return &ChainBuilder{}
+}
+
+// Text 添加文字，\r\n 会统一转为 \n
+func (b *ChainBuilder) Text(text string) *ChainBuilder {
+	if len(text) == 0 {
+		return b
+	}
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	if len(b.chain) > 0 {
+		if last, ok := b.chain[len(b.chain)-1].(*Plain); ok {
+			b.chain[len(b.chain)-1] = &Plain{Type: "Plain", Text: last.Text + text}
+			return b
+		}
+	}
+	b.chain = append(b.chain, &Plain{Type: "Plain", Text: text})
+	return b
+}
+
+// Textf 添加格式化的文字
+func (b *ChainBuilder) Textf(format string, a ...any) *ChainBuilder {
+	return b.Text(fmt.Sprintf(format, a...))
+}
+
+// Line 添加一行文字，末尾自动加上换行
+func (b *ChainBuilder) Line(text string) *ChainBuilder {
+	return b.Text(text + "\n")
+}
+
+// Newline 添加一个换行
+func (b *ChainBuilder) Newline() *ChainBuilder {
+	return b.Text("\n")
+}
+
+// At 添加@消息
+func (b *ChainBuilder) At(qq int64) *ChainBuilder {
+	return b.Append(&At{Target: qq})
+}
+
+// AtAll 添加@全体成员
+func (b *ChainBuilder) AtAll() *ChainBuilder {
+	return b.Append(&AtAll{})
+}
+
+// Face 根据表情拼音或名称添加QQ表情
+func (b *ChainBuilder) Face(name string) *ChainBuilder {
+	return b.Append(&Face{Name: name})
+}
+
+// FaceId 根据表情编号添加QQ表情
+func (b *ChainBuilder) FaceId(faceId int32) *ChainBuilder {
+	return b.Append(&Face{FaceId: faceId})
+}
+
+// Image 根据imageId添加图片
+func (b *ChainBuilder) Image(imageId string) *ChainBuilder {
+	return b.Append(&Image{ImageId: imageId})
+}
+
+// ImageURL 添加网络图片
+func (b *ChainBuilder) ImageURL(url string) *ChainBuilder {
+	return b.Append(&Image{Url: url})
+}
+
+// ImageBase64 添加Base64编码的图片
+func (b *ChainBuilder) ImageBase64(base64 string) *ChainBuilder {
+	return b.Append(&Image{Base64: base64})
+}
+
+// Dice 添加骰子
+func (b *ChainBuilder) Dice(value int32) *ChainBuilder {
+	return b.Append(&Dice{Value: value})
+}
+
+// Poke 添加戳一戳
+func (b *ChainBuilder) Poke(name PokeName) *ChainBuilder {
+	return b.Append(&Poke{Name: name})
+}
+
+// Quote 引用回复一条消息，src为被回复消息的 Source 。一条消息链最多只能引用一条消息。
+// 发送 Build 得到的消息链时，如果没有指定quote参数，会使用这里的引用回复
+func (b *ChainBuilder) Quote(src *Source) *ChainBuilder {
+	if src == nil {
+		return b.fail(fmt.Errorf("quote source is nil"))
+	}
+	return b.quote(src.Id)
+}
+
+func (b *ChainBuilder) quote(id int64) *ChainBuilder {
+	for _, m := range b.chain {
+		if _, ok := m.(*Quote); ok {
+			return b.fail(fmt.Errorf("message chain can only contain one quote"))
+		}
+	}
+	b.chain = append(b.chain, &Quote{Type: "Quote", Id: id, fromBuilder: true})
+	return b
+}
+
+// Append 添加任意消息，不可发送的消息（如 Source 、 MarketFace 、 File ）会导致 Build 返回错误。
+// 添加的是消息的拷贝，不会修改传入的消息。 Quote 只会保留被回复消息的id，等同于 ChainBuilder.Quote
+func (b *ChainBuilder) Append(messages ...SingleMessage) *ChainBuilder {
+	for _, m := range messages {
+		if m == nil {
+			continue
+		}
+		if err := checkSendable(m); err != nil {
+			return b.fail(err)
+		}
+		switch m := m.(type) {
+		case *Plain:
+			b.Text(m.Text)
+			continue
+		case *Quote:
+			b.quote(m.Id)
+			continue
+		}
+		m = cloneMessage(m)
+		m.FillMessageType()
+		b.chain = append(b.chain, m)
+	}
+	return b
+}
+
+// cloneMessage 浅拷贝一条消息
+func cloneMessage(m SingleMessage) SingleMessage {
+	v := reflect.ValueOf(m).Elem()
+	c := reflect.New(v.Type())
+	c.Elem().Set(v)
+	return c.Interface().(SingleMessage)
+}
+
+func (b *ChainBuilder) fail(err error) *ChainBuilder {
+	if b.err == nil {
+		b.err = err
+	}
+	return b
+}
+
+// Build 返回构造好的消息链，如果构造过程中出现了错误，则返回第一个错误
+func (b *ChainBuilder) Build() (MessageChain, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+	if len(b.chain) == 0 {
+		return nil, fmt.Errorf("message chain is empty")
+	}
+	return append(MessageChain(nil), b.chain...), nil
+}
+
+// checkSendable 检查消息是否可以构造发送
+func checkSendable(m SingleMessage) error {
+	switch m.(type) {
+	case *Source, *MarketFace, *File:
+		return fmt.Errorf("message type %T cannot be sent", m)
+	}
+	return nil
+}
+
+// extractQuote 如果消息链中有 ChainBuilder 添加的 Quote ，则把它从消息链中去掉，quote为0时用它作为引用回复的消息。
+// 其它的 Quote （例如收到的消息链中的）保持不变
+func extractQuote(quote int64, messageChain MessageChain) (int64, MessageChain) {
+	for i, m := range messageChain {
+		if q, ok := m.(*Quote); ok && q.fromBuilder {
+			if quote == 0 {
+				quote = q.Id
+			}
+			ret := make(MessageChain, 0, len(messageChain)-1)
+			ret = append(ret, messageChain[:i]...)
+			return quote, append(ret, messageChain[i+1:]...)
+		}
+	}
+	return quote, messageChain
+}
@@ -0,0 +1,99 @@
+package miraihttp
+
+import (
+	"fmt"
+	"strings"
+)
+
+// String 把消息链中每个元素的文字描述拼接起来
+func (c MessageChain) String() string {
+	var sb strings.Builder
+	for _, m := range c {
+		if s, ok := m.(fmt.Stringer); ok {
+			sb.WriteString(s.String())
+		}
+	}
+	return sb.String()
+}
+
+// PlainText 只拼接消息链中的文字消息
+func (c MessageChain) PlainText() string {
+	var sb strings.Builder
+	for _, m := range c {
+		if p, ok := m.(*Plain); ok {
+			sb.WriteString(p.Text)
+		}
+	}
+	return sb.String()
+}
+
+// Source 获取消息链中的 Source ，没有则返回nil
+func (c MessageChain) Source() *Source {
+	m, _ := First[*Source](c)
+	return m
+}
+
+// Quote 获取消息链中的 Quote ，没有则返回nil
+func (c MessageChain) Quote() *Quote {
+	m, _ := First[*Quote](c)
+	return m
+}
+
+// Ats 获取消息链中所有被@的QQ号
+func (c MessageChain) Ats() []int64 {
+	var ret []int64
+	for _, at := range Filter[*At](c) {
+		ret = append(ret, at.Target)
+	}
+	return ret
+}
+
+// IsAtBot 消息链中是否@了指定的QQ号（一般传入 Bot.QQ ），@全体成员不算
+func (c MessageChain) IsAtBot(qq int64) bool {
+	for _, m := range c {
+		if at, ok := m.(*At); ok && at.Target == qq {
+			return true
+		}
+	}
+	return false
+}
+
+// Images 获取消息链中所有的图片
+func (c MessageChain) Images() []*Image {
+	return Filter[*Image](c)
+}
+
+// TrimSource 返回去掉 Source 之后的消息链，不会修改原消息链
+func (c MessageChain) TrimSource() MessageChain {
+	ret := make(MessageChain, 0, len(c))
+	for _, m := range c {
+		if _, ok := m.(*Source); !ok {
+			ret = append(ret, m)
+		}
+	}
+	return ret
+}
+
+// First 获取消息链中第一个类型为T的元素
+//
+//	if face, ok := First[*Face](message.MessageChain); ok { ... }
+func First[T SingleMessage](c MessageChain) (T, bool) {
+	for _, m := range c {
+		if t, ok := m.(T); ok {
+			return t, true
+		}
+	}
+	var zero T
+	return zero, false
+}
+
+// Filter 获取消息链中所有类型为T的元素
+func Filter[T SingleMessage](c MessageChain) []T {
+	var ret []T
+	for _, m := range c {
+		if t, ok := m.(T); ok {
+			ret = append(ret, t)
+		}
+	}
+	return ret
+}
@@ -0,0 +1,137 @@
+package miraihttp
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ForwardBuilder 转发消息构造器
+//
+//	forward, err := NewForward().AddGroupMessage(m1).AddMessageId(123).AddNode(qq, "名字", 0, chain).Build()
+type ForwardBuilder struct {
+	display  *ForwardDisplay
+	nodeList []*ForwardMessageNode
+}
+
+// NewForward 新建一个转发消息构造器
+func NewForward() *ForwardBuilder {
+	return &ForwardBuilder{}
+}
+
+// Display 设置转发消息的卡片显示文本
+func (b *ForwardBuilder) Display(display *ForwardDisplay) *ForwardBuilder {
+	b.display = display
+	return b
+}
+
+// AddNode 用指定的发送者构造一个节点，timestamp为0表示使用当前时间
+func (b *ForwardBuilder) AddNode(senderId int64, senderName string, timestamp int64, messageChain MessageChain) *ForwardBuilder {
+	if timestamp == 0 {
+		timestamp = time.Now().Unix()
+	}
+	b.nodeList = append(b.nodeList, &ForwardMessageNode{
+		SenderId:     senderId,
+		Time:         timestamp,
+		SenderName:   senderName,
+		MessageChain: messageChain.TrimSource(),
+	})
+	return b
+}
+
+// AddGroupMessage 把收到的群消息作为一个节点，会直接使用消息的内容，不依赖mirai的消息缓存
+func (b *ForwardBuilder) AddGroupMessage(message *GroupMessage) *ForwardBuilder {
+	var timestamp int64
+	if src := message.MessageChain.Source(); src != nil {
+		timestamp = src.Time
+	}
+	return b.AddNode(message.Sender.Id, message.Sender.MemberName, timestamp, message.MessageChain)
+}
+
+// AddFriendMessage 把收到的好友消息作为一个节点，会直接使用消息的内容，不依赖mirai的消息缓存
+func (b *ForwardBuilder) AddFriendMessage(message *FriendMessage) *ForwardBuilder {
+	var timestamp int64
+	if src := message.MessageChain.Source(); src != nil {
+		timestamp = src.Time
+	}
+	return b.AddNode(message.Sender.Id, message.Sender.Nickname, timestamp, message.MessageChain)
+}
+
+// AddForward 把另一条转发消息嵌套作为一个节点
+func (b *ForwardBuilder) AddForward(senderId int64, senderName string, timestamp int64, forward *ForwardMessage) *ForwardBuilder {
+	return b.AddNode(senderId, senderName, timestamp, MessageChain{forward})
+}
+
+// AddMessageId 从当前对话上下文缓存中读取一条消息作为节点
+func (b *ForwardBuilder) AddMessageId(messageId int64) *ForwardBuilder {
+	b.nodeList = append(b.nodeList, &ForwardMessageNode{MessageId: messageId})
+	return b
+}
+
+// AddMessageRef 引用缓存中其他对话上下文的消息作为节点，target-消息所在的好友或群
+func (b *ForwardBuilder) AddMessageRef(messageId, target int64) *ForwardBuilder {
+	b.nodeList = append(b.nodeList, &ForwardMessageNode{MessageRef: &MessageRef{MessageId: messageId, Target: target}})
+	return b
+}
+
+// Build 校验并返回构造好的转发消息
+func (b *ForwardBuilder) Build() (*ForwardMessage, error) {
+	m := &ForwardMessage{Display: b.display, NodeList: b.nodeList}
+	if err := m.Validate(); err != nil {
+		return nil, err
+	}
+	m.FillMessageType()
+	return m, nil
+}
+
+// Validate 校验转发消息的每个节点是否恰好使用了一种构造方式，会递归检查嵌套的转发消息
+func (m *ForwardMessage) Validate() error {
+	if len(m.NodeList) == 0 {
+		return errors.New("forward message has no node")
+	}
+	for i, node := range m.NodeList {
+		if node == nil {
+			return fmt.Errorf("forward message node %d is nil", i)
+		}
+		if err := node.validate(); err != nil {
+			return fmt.Errorf("forward message node %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+func (n *ForwardMessageNode) validate() error {
+	hasContent := n.SenderId != 0 || n.Time != 0 || n.SenderName != "" || len(n.MessageChain) > 0
+	ways := 0
+	if hasContent {
+		ways++
+	}
+	if n.MessageId != 0 {
+		ways++
+	}
+	if n.MessageRef != nil {
+		ways++
+	}
+	switch {
+	case ways == 0:
+		return errors.New("node is empty")
+	case ways > 1:
+		return errors.New("(senderId, time, senderName, messageChain), messageId and messageRef are mutually exclusive")
+	case hasContent:
+		if n.SenderId == 0 || len(n.MessageChain) == 0 {
+			return errors.New("senderId and messageChain are required")
+		}
+		for _, m := range n.MessageChain {
+			if forward, ok := m.(*ForwardMessage); ok {
+				if err := forward.Validate(); err != nil {
+					return err
+				}
+			}
+		}
+	case n.MessageRef != nil:
+		if n.MessageRef.MessageId == 0 || n.MessageRef.Target == 0 {
+			return errors.New("messageRef requires messageId and target")
+		}
+	}
+	return nil
+}
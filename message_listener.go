@@ -20,8 +20,8 @@ func init() {
 
 // FriendMessage 好友消息
 type FriendMessage struct {
-	Sender       Friend
-	MessageChain MessageChain
+	Sender       Friend       `json:"sender"`
+	MessageChain MessageChain `json:"messageChain"`
 }
 
 // ListenFriendMessage 监听好友消息
@@ -46,8 +46,8 @@ func parseFriendMessage(data gjson.Result) any {
 
 // GroupMessage 群消息
 type GroupMessage struct {
-	Sender       Member
-	MessageChain MessageChain
+	Sender       Member       `json:"sender"`
+	MessageChain MessageChain `json:"messageChain"`
 }
 
 // ListenGroupMessage 监听群消息
@@ -72,8 +72,8 @@ func parseGroupMessage(data gjson.Result) any {
 
 // TempMessage 群临时消息
 type TempMessage struct {
-	Sender       Member
-	MessageChain MessageChain
+	Sender       Member       `json:"sender"`
+	MessageChain MessageChain `json:"messageChain"`
 }
 
 // ListenTempMessage 监听群临时消息
@@ -98,8 +98,8 @@ func parseTempMessage(data gjson.Result) any {
 
 // StrangerMessage 陌生人消息
 type StrangerMessage struct {
-	Sender       Friend
-	MessageChain MessageChain
+	Sender       Friend       `json:"sender"`
+	MessageChain MessageChain `json:"messageChain"`
 }
 
 // ListenStrangerMessage 监听陌生人消息
@@ -129,8 +129,8 @@ type OtherClient struct {
 
 // OtherClientMessage 其他客户端消息
 type OtherClientMessage struct {
-	Sender       OtherClient
-	MessageChain MessageChain
+	Sender       OtherClient  `json:"sender"`
+	MessageChain MessageChain `json:"messageChain"`
 }
 
 // ListenOtherClientMessage 监听其他客户端消息
@@ -155,8 +155,8 @@ func parseOtherClientMessage(data gjson.Result) any {
 
 // FriendSyncMessage 同步好友消息
 type FriendSyncMessage struct {
-	Subject      Friend
-	MessageChain MessageChain
+	Subject      Friend       `json:"subject"`
+	MessageChain MessageChain `json:"messageChain"`
 }
 
 // ListenFriendSyncMessage 监听同步好友消息
@@ -181,8 +181,8 @@ func parseFriendSyncMessage(data gjson.Result) any {
 
 // GroupSyncMessage 同步群消息
 type GroupSyncMessage struct {
-	Subject      Group
-	MessageChain MessageChain
+	Subject      Group        `json:"subject"`
+	MessageChain MessageChain `json:"messageChain"`
 }
 
 // ListenGroupSyncMessage 监听同步群消息
@@ -207,8 +207,8 @@ func parseGroupSyncMessage(data gjson.Result) any {
 
 // TempSyncMessage 同步群临时消息
 type TempSyncMessage struct {
-	Subject      Member
-	MessageChain MessageChain
+	Subject      Member       `json:"subject"`
+	MessageChain MessageChain `json:"messageChain"`
 }
 
 // ListenTempSyncMessage 监听同步群临时消息
@@ -233,8 +233,8 @@ func parseTempSyncMessage(data gjson.Result) any {
 
 // StrangerSyncMessage 同步好友消息
 type StrangerSyncMessage struct {
-	Subject      Friend
-	MessageChain MessageChain
+	Subject      Friend       `json:"subject"`
+	MessageChain MessageChain `json:"messageChain"`
 }
 
 // ListenStrangerSyncMessage 监听同步好友消息
@@ -0,0 +1,292 @@
+package miraihttp
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Repliable 可以回复的消息，包括收到的消息和同步消息
+type Repliable interface {
+	// ReplyTo 回复时发往的地方
+	ReplyTo() Subject
+
+	// Reply 回复这条消息
+	Reply(b *Bot, messageChain MessageChain) (int64, error)
+
+	// QuoteReply 引用回复这条消息
+	QuoteReply(b *Bot, messageChain MessageChain) (int64, error)
+
+	// Recall 撤回这条消息
+	Recall(b *Bot) error
+}
+
+var (
+	_ Repliable = (*FriendMessage)(nil)
+	_ Repliable = (*GroupMessage)(nil)
+	_ Repliable = (*TempMessage)(nil)
+	_ Repliable = (*StrangerMessage)(nil)
+	_ Repliable = (*FriendSyncMessage)(nil)
+	_ Repliable = (*GroupSyncMessage)(nil)
+	_ Repliable = (*TempSyncMessage)(nil)
+	_ Repliable = (*StrangerSyncMessage)(nil)
+	_ Repliable = (*SentMessage)(nil)
+)
+
+// Subject 消息的来源，回复消息时发往这里
+type Subject struct {
+	Kind  Kind  `json:"kind"`            // 来源的类型
+	Id    int64 `json:"id"`              // 好友或陌生人的QQ号，群号，或者临时会话对象的QQ号
+	Group int64 `json:"group,omitempty"` // 临时会话所在的群号，只有 Kind 为 KindTemp 时才有
+}
+
+// Send 向这个来源发送消息，quote-引用回复的消息，返回消息id
+func (s Subject) Send(b *Bot, quote int64, messageChain MessageChain) (int64, error) {
+	switch s.Kind {
+	case KindGroup:
+		return b.SendGroupMessage(s.Id, quote, messageChain)
+	case KindFriend, KindStranger:
+		return b.SendFriendMessage(s.Id, quote, messageChain)
+	case KindTemp:
+		return b.SendTempMessage(s.Id, s.Group, quote, messageChain)
+	default:
+		return 0, fmt.Errorf("cannot send message to subject kind: %s", s.Kind)
+	}
+}
+
+// Recall 撤回这个来源中的一条消息
+func (s Subject) Recall(b *Bot, messageId int64) error {
+	return b.Recall(s.Id, messageId)
+}
+
+// quoteReply 引用回复消息链对应的消息
+func quoteReply(b *Bot, s Subject, source MessageChain, messageChain MessageChain) (int64, error) {
+	src := source.Source()
+	if src == nil {
+		return 0, errors.New("cannot find source in message chain")
+	}
+	return s.Send(b, src.Id, messageChain)
+}
+
+// recallMessage 撤回消息链对应的消息
+func recallMessage(b *Bot, s Subject, messageChain MessageChain) error {
+	src := messageChain.Source()
+	if src == nil {
+		return errors.New("cannot find source in message chain")
+	}
+	return s.Recall(b, src.Id)
+}
+
+// Subject 消息来源，即发送消息的好友
+func (m *FriendMessage) Subject() Subject {
+	return Subject{Kind: KindFriend, Id: m.Sender.Id}
+}
+
+// ReplyTo 回复时发往的地方，等同于 Subject
+func (m *FriendMessage) ReplyTo() Subject {
+	return m.Subject()
+}
+
+// Reply 回复这条消息
+func (m *FriendMessage) Reply(b *Bot, messageChain MessageChain) (int64, error) {
+	return m.Subject().Send(b, 0, messageChain)
+}
+
+// QuoteReply 引用回复这条消息
+func (m *FriendMessage) QuoteReply(b *Bot, messageChain MessageChain) (int64, error) {
+	return quoteReply(b, m.Subject(), m.MessageChain, messageChain)
+}
+
+// Recall 撤回这条消息
+func (m *FriendMessage) Recall(b *Bot) error {
+	return recallMessage(b, m.Subject(), m.MessageChain)
+}
+
+// Subject 消息来源，即消息所在的群
+func (m *GroupMessage) Subject() Subject {
+	return Subject{Kind: KindGroup, Id: m.Sender.Group.Id}
+}
+
+// ReplyTo 回复时发往的地方，等同于 Subject
+func (m *GroupMessage) ReplyTo() Subject {
+	return m.Subject()
+}
+
+// Reply 回复这条消息
+func (m *GroupMessage) Reply(b *Bot, messageChain MessageChain) (int64, error) {
+	return m.Subject().Send(b, 0, messageChain)
+}
+
+// QuoteReply 引用回复这条消息
+func (m *GroupMessage) QuoteReply(b *Bot, messageChain MessageChain) (int64, error) {
+	return quoteReply(b, m.Subject(), m.MessageChain, messageChain)
+}
+
+// Recall 撤回这条消息（需要有相关限权）
+func (m *GroupMessage) Recall(b *Bot) error {
+	return recallMessage(b, m.Subject(), m.MessageChain)
+}
+
+// Subject 消息来源，即临时会话的对象
+func (m *TempMessage) Subject() Subject {
+	return Subject{Kind: KindTemp, Id: m.Sender.Id, Group: m.Sender.Group.Id}
+}
+
+// ReplyTo 回复时发往的地方，等同于 Subject
+func (m *TempMessage) ReplyTo() Subject {
+	return m.Subject()
+}
+
+// Reply 回复这条消息
+func (m *TempMessage) Reply(b *Bot, messageChain MessageChain) (int64, error) {
+	return m.Subject().Send(b, 0, messageChain)
+}
+
+// QuoteReply 引用回复这条消息
+func (m *TempMessage) QuoteReply(b *Bot, messageChain MessageChain) (int64, error) {
+	return quoteReply(b, m.Subject(), m.MessageChain, messageChain)
+}
+
+// Recall 撤回这条消息
+func (m *TempMessage) Recall(b *Bot) error {
+	return recallMessage(b, m.Subject(), m.MessageChain)
+}
+
+// Subject 消息来源，即发送消息的陌生人
+func (m *StrangerMessage) Subject() Subject {
+	return Subject{Kind: KindStranger, Id: m.Sender.Id}
+}
+
+// ReplyTo 回复时发往的地方，等同于 Subject
+func (m *StrangerMessage) ReplyTo() Subject {
+	return m.Subject()
+}
+
+// Reply 回复这条消息
+func (m *StrangerMessage) Reply(b *Bot, messageChain MessageChain) (int64, error) {
+	return m.Subject().Send(b, 0, messageChain)
+}
+
+// QuoteReply 引用回复这条消息
+func (m *StrangerMessage) QuoteReply(b *Bot, messageChain MessageChain) (int64, error) {
+	return quoteReply(b, m.Subject(), m.MessageChain, messageChain)
+}
+
+// Recall 撤回这条消息
+func (m *StrangerMessage) Recall(b *Bot) error {
+	return recallMessage(b, m.Subject(), m.MessageChain)
+}
+
+// Reply 其他客户端消息无法回复，总是返回错误
+func (m *OtherClientMessage) Reply(*Bot, MessageChain) (int64, error) {
+	return 0, errors.New("cannot reply to other client message")
+}
+
+// QuoteReply 其他客户端消息无法回复，总是返回错误
+func (m *OtherClientMessage) QuoteReply(*Bot, MessageChain) (int64, error) {
+	return 0, errors.New("cannot reply to other client message")
+}
+
+// Recall 其他客户端消息无法撤回，总是返回错误
+func (m *OtherClientMessage) Recall(*Bot) error {
+	return errors.New("cannot recall other client message")
+}
+
+// ReplyTo 回复时发往的地方，即同步消息的目标好友
+func (m *FriendSyncMessage) ReplyTo() Subject {
+	return Subject{Kind: KindFriend, Id: m.Subject.Id}
+}
+
+// Reply 向这条同步消息的目标好友发送消息
+func (m *FriendSyncMessage) Reply(b *Bot, messageChain MessageChain) (int64, error) {
+	return m.ReplyTo().Send(b, 0, messageChain)
+}
+
+// QuoteReply 引用回复这条同步消息
+func (m *FriendSyncMessage) QuoteReply(b *Bot, messageChain MessageChain) (int64, error) {
+	return quoteReply(b, m.ReplyTo(), m.MessageChain, messageChain)
+}
+
+// Recall 撤回这条同步消息
+func (m *FriendSyncMessage) Recall(b *Bot) error {
+	return recallMessage(b, m.ReplyTo(), m.MessageChain)
+}
+
+// ReplyTo 回复时发往的地方，即同步消息的目标群
+func (m *GroupSyncMessage) ReplyTo() Subject {
+	return Subject{Kind: KindGroup, Id: m.Subject.Id}
+}
+
+// Reply 向这条同步消息的目标群发送消息
+func (m *GroupSyncMessage) Reply(b *Bot, messageChain MessageChain) (int64, error) {
+	return m.ReplyTo().Send(b, 0, messageChain)
+}
+
+// QuoteReply 引用回复这条同步消息
+func (m *GroupSyncMessage) QuoteReply(b *Bot, messageChain MessageChain) (int64, error) {
+	return quoteReply(b, m.ReplyTo(), m.MessageChain, messageChain)
+}
+
+// Recall 撤回这条同步消息
+func (m *GroupSyncMessage) Recall(b *Bot) error {
+	return recallMessage(b, m.ReplyTo(), m.MessageChain)
+}
+
+// ReplyTo 回复时发往的地方，即同步消息的临时会话对象
+func (m *TempSyncMessage) ReplyTo() Subject {
+	return Subject{Kind: KindTemp, Id: m.Subject.Id, Group: m.Subject.Group.Id}
+}
+
+// Reply 向这条同步消息的临时会话对象发送消息
+func (m *TempSyncMessage) Reply(b *Bot, messageChain MessageChain) (int64, error) {
+	return m.ReplyTo().Send(b, 0, messageChain)
+}
+
+// QuoteReply 引用回复这条同步消息
+func (m *TempSyncMessage) QuoteReply(b *Bot, messageChain MessageChain) (int64, error) {
+	return quoteReply(b, m.ReplyTo(), m.MessageChain, messageChain)
+}
+
+// Recall 撤回这条同步消息
+func (m *TempSyncMessage) Recall(b *Bot) error {
+	return recallMessage(b, m.ReplyTo(), m.MessageChain)
+}
+
+// ReplyTo 回复时发往的地方，即同步消息的目标陌生人
+func (m *StrangerSyncMessage) ReplyTo() Subject {
+	return Subject{Kind: KindStranger, Id: m.Subject.Id}
+}
+
+// Reply 向这条同步消息的目标陌生人发送消息
+func (m *StrangerSyncMessage) Reply(b *Bot, messageChain MessageChain) (int64, error) {
+	return m.ReplyTo().Send(b, 0, messageChain)
+}
+
+// QuoteReply 引用回复这条同步消息
+func (m *StrangerSyncMessage) QuoteReply(b *Bot, messageChain MessageChain) (int64, error) {
+	return quoteReply(b, m.ReplyTo(), m.MessageChain, messageChain)
+}
+
+// Recall 撤回这条同步消息
+func (m *StrangerSyncMessage) Recall(b *Bot) error {
+	return recallMessage(b, m.ReplyTo(), m.MessageChain)
+}
+
+// ReplyTo 回复时发往的地方，即这条消息发往的地方
+func (m *SentMessage) ReplyTo() Subject {
+	return m.Target
+}
+
+// Reply 向这条消息发往的地方发送消息
+func (m *SentMessage) Reply(b *Bot, messageChain MessageChain) (int64, error) {
+	return m.Target.Send(b, 0, messageChain)
+}
+
+// QuoteReply 引用回复这条发出的消息
+func (m *SentMessage) QuoteReply(b *Bot, messageChain MessageChain) (int64, error) {
+	return quoteReply(b, m.Target, m.MessageChain, messageChain)
+}
+
+// Recall 撤回这条发出的消息
+func (m *SentMessage) Recall(b *Bot) error {
+	return recallMessage(b, m.Target, m.MessageChain)
+}
@@ -0,0 +1,72 @@
+package miraihttp
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestReply(t *testing.T) {
+	s, b := newTestBot(t, nil)
+	chain := MessageChain{&Source{Id: 7}, &Plain{Text: "hi"}}
+	member := Member{Id: 1, Group: Group{Id: 100}}
+	for _, c := range []struct {
+		message Repliable
+		command string
+		target  int64 // sendTempMessage 时为qq
+		group   int64 // 只有 sendTempMessage 时才有
+	}{
+		{&FriendMessage{Sender: Friend{Id: 1}, MessageChain: chain}, "sendFriendMessage", 1, 0},
+		{&GroupMessage{Sender: member, MessageChain: chain}, "sendGroupMessage", 100, 0},
+		{&TempMessage{Sender: member, MessageChain: chain}, "sendTempMessage", 1, 100},
+		{&StrangerMessage{Sender: Friend{Id: 1}, MessageChain: chain}, "sendFriendMessage", 1, 0},
+		{&FriendSyncMessage{Subject: Friend{Id: 2}, MessageChain: chain}, "sendFriendMessage", 2, 0},
+		{&GroupSyncMessage{Subject: Group{Id: 200}, MessageChain: chain}, "sendGroupMessage", 200, 0},
+		{&TempSyncMessage{Subject: Member{Id: 3, Group: Group{Id: 300}}, MessageChain: chain}, "sendTempMessage", 3, 300},
+		{&StrangerSyncMessage{Subject: Friend{Id: 4}, MessageChain: chain}, "sendFriendMessage", 4, 0},
+	} {
+		t.Run(c.command, func(t *testing.T) {
+			checkTarget := func(req *testRequest) {
+				require.NotNil(t, req)
+				assert.Equal(t, c.command, req.Command)
+				if c.command == "sendTempMessage" {
+					assert.Equal(t, c.target, req.Content.Get("qq").Int())
+					assert.Equal(t, c.group, req.Content.Get("group").Int())
+				} else {
+					assert.Equal(t, c.target, req.Content.Get("target").Int())
+				}
+			}
+
+			_, err := c.message.Reply(b, MessageChain{&Plain{Text: "reply"}})
+			assert.NoError(t, err)
+			req := s.Last()
+			checkTarget(req)
+			assert.False(t, req.Content.Get("quote").Exists())
+			assert.Equal(t, "reply", req.Content.Get("messageChain.0.text").String())
+
+			_, err = c.message.QuoteReply(b, MessageChain{&Plain{Text: "quote"}})
+			assert.NoError(t, err)
+			req = s.Last()
+			checkTarget(req)
+			assert.Equal(t, int64(7), req.Content.Get("quote").Int())
+
+			assert.NoError(t, c.message.Recall(b))
+			req = s.Last()
+			assert.Equal(t, "recall", req.Command)
+			assert.Equal(t, c.message.ReplyTo().Id, req.Content.Get("target").Int())
+			assert.Equal(t, int64(7), req.Content.Get("messageId").Int())
+		})
+	}
+
+	_, err := (&GroupMessage{Sender: member}).QuoteReply(b, MessageChain{&Plain{Text: "a"}})
+	assert.Error(t, err)
+	_, err = (&OtherClientMessage{}).Reply(b, MessageChain{&Plain{Text: "a"}})
+	assert.Error(t, err)
+}
+
+func TestReplyTo(t *testing.T) {
+	assert.Equal(t, Subject{Kind: KindTemp, Id: 1, Group: 100}, (&TempMessage{Sender: Member{Id: 1, Group: Group{Id: 100}}}).ReplyTo())
+	assert.Equal(t, Subject{Kind: KindGroup, Id: 100}, (&GroupMessage{Sender: Member{Id: 1, Group: Group{Id: 100}}}).ReplyTo())
+	assert.Equal(t, Subject{Kind: KindGroup, Id: 200}, (&GroupSyncMessage{Subject: Group{Id: 200}}).ReplyTo())
+	assert.Equal(t, Subject{Kind: KindStranger, Id: 4}, (&StrangerSyncMessage{Subject: Friend{Id: 4}}).ReplyTo())
+}
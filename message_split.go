@@ -0,0 +1,181 @@
+package miraihttp
+
+import (
+	"errors"
+	"strings"
+	"unicode/utf8"
+)
+
+// SplitMode 超长消息的处理方式
+type SplitMode int
+
+const (
+	SplitModeMultiple SplitMode = iota // 拆分成多条消息依次发送
+	SplitModeForward                   // 拆分后折叠成一条转发消息发送，At 、 AtAll 和 Quote 在转发消息之前单独发送
+)
+
+// DefaultMaxMessageLength 默认的单条消息最大长度
+const DefaultMaxMessageLength = 4500
+
+// SplitOption 超长消息的拆分选项
+type SplitOption struct {
+	Mode       SplitMode // 超长消息的处理方式
+	MaxLength  int       // 单条消息的最大长度，为0时使用 DefaultMaxMessageLength
+	SenderName string    // SplitModeForward 时每个节点显示的名称
+}
+
+// MessageLength 计算消息链的长度，文字按字符数计算，其它消息按其文字描述的字符数计算。
+//
+// 这只是一个估计值：mirai并不是按字符数限制消息长度的，实际的限制取决于消息编码后的大小，
+// 中文、表情、图片等占用的大小都比一个英文字符多。 DefaultMaxMessageLength 已经留有余量，
+// 如果仍然被拒绝，可以调小 SplitOption.MaxLength 。
+func MessageLength(messageChain MessageChain) int {
+	length := 0
+	for _, m := range messageChain {
+		length += singleMessageLength(m)
+	}
+	return length
+}
+
+func singleMessageLength(m SingleMessage) int {
+	switch m := m.(type) {
+	case *Source, *Quote:
+		return 0
+	case *Plain:
+		return utf8.RuneCountInString(m.Text)
+	default:
+		return utf8.RuneCountInString(MessageChain{m}.String())
+	}
+}
+
+// SplitMessageChain 把消息链拆分成若干条长度不超过maxLength的消息链。
+// 过长的文字会优先在换行处拆开，否则在字符边界拆开，其它消息不会被拆开，Source 会被去掉。
+// 需要拆分时，所有的 At 、 AtAll 和 Quote 会按原来的顺序移到第一条消息的开头。
+func SplitMessageChain(messageChain MessageChain, maxLength int) []MessageChain {
+	if maxLength <= 0 {
+		maxLength = DefaultMaxMessageLength
+	}
+	messageChain = messageChain.TrimSource()
+	if len(messageChain) == 0 {
+		return nil
+	}
+	if MessageLength(messageChain) <= maxLength {
+		return []MessageChain{messageChain}
+	}
+	header, body := splitHeader(messageChain)
+	var ret []MessageChain
+	current, currentLength := header, MessageLength(header)
+	flush := func() {
+		if len(current) > 0 {
+			ret = append(ret, current)
+			current, currentLength = nil, 0
+		}
+	}
+	for _, m := range body {
+		p, ok := m.(*Plain)
+		if !ok {
+			length := singleMessageLength(m)
+			if currentLength+length > maxLength && currentLength > 0 {
+				flush()
+			}
+			current = append(current, m)
+			currentLength += length
+			continue
+		}
+		text := p.Text
+		for len(text) > 0 {
+			if currentLength >= maxLength {
+				flush()
+			}
+			part := cutText(text, maxLength-currentLength)
+			current = append(current, &Plain{Type: "Plain", Text: part})
+			currentLength += utf8.RuneCountInString(part)
+			text = text[len(part):]
+		}
+	}
+	flush()
+	return ret
+}
+
+// splitHeader 把消息链中的 At 、 AtAll 和 Quote 按原来的顺序取出来，返回它们和剩下的消息
+func splitHeader(messageChain MessageChain) (header, body MessageChain) {
+	for _, m := range messageChain {
+		switch m.(type) {
+		case *At, *AtAll, *Quote:
+			header = append(header, m)
+		default:
+			body = append(body, m)
+		}
+	}
+	return header, body
+}
+
+// cutText 从text开头切出最多limit个字符，优先在换行处切开
+func cutText(text string, limit int) string {
+	if utf8.RuneCountInString(text) <= limit {
+		return text
+	}
+	end := 0
+	for i := 0; i < limit; i++ {
+		_, size := utf8.DecodeRuneInString(text[end:])
+		end += size
+	}
+	if i := strings.LastIndexByte(text[:end], '\n'); i >= 0 {
+		return text[:i+1]
+	}
+	return text[:end]
+}
+
+// SendLongMessage 发送可能超长的消息，超长时按照opt拆分，返回所有发出的消息的id。
+// quote只会用于第一条消息，如果没有超长，则等同于直接发送。
+// SplitModeForward 时 At 、 AtAll 和 Quote 在转发消息中不起作用，所以会先把它们作为一条普通消息发出。
+func (b *Bot) SendLongMessage(subject Subject, quote int64, messageChain MessageChain, opt SplitOption) ([]int64, error) {
+	quote, messageChain = extractQuote(quote, messageChain)
+	chains := SplitMessageChain(messageChain, opt.MaxLength)
+	if len(chains) == 0 {
+		return nil, errors.New("message chain is empty")
+	}
+	if len(chains) == 1 {
+		id, err := subject.Send(b, quote, chains[0])
+		if err != nil {
+			return nil, err
+		}
+		return []int64{id}, nil
+	}
+	if opt.Mode == SplitModeForward {
+		header, body := splitHeader(messageChain.TrimSource())
+		builder := NewForward()
+		for _, c := range SplitMessageChain(body, opt.MaxLength) {
+			builder.AddNode(b.QQ, opt.SenderName, 0, c)
+		}
+		forward, err := builder.Build()
+		if err != nil {
+			return nil, err
+		}
+		var ids []int64
+		if len(header) > 0 {
+			id, err := subject.Send(b, quote, header)
+			if err != nil {
+				return nil, err
+			}
+			ids, quote = append(ids, id), 0
+		}
+		id, err := subject.Send(b, quote, MessageChain{forward})
+		if err != nil {
+			return ids, err
+		}
+		return append(ids, id), nil
+	}
+	ids := make([]int64, 0, len(chains))
+	for i, c := range chains {
+		if i > 0 {
+			quote = 0
+		}
+		id, err := subject.Send(b, quote, c)
+		if err != nil {
+			return ids, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
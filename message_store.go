@@ -0,0 +1,530 @@
+package miraihttp
+
+import (
+	"bufio"
+	"container/list"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sync"
+)
+
+// MessageStore 消息存储，用于在本地记录收到和发出的消息，
+// 记录的消息是 *FriendMessage, *GroupMessage, *TempMessage, *StrangerMessage 、各种同步消息以及 *SentMessage 之一
+type MessageStore interface {
+	// Put 记录一条消息，target-好友QQ号或群号，messageId-消息id
+	Put(target, messageId int64, message any) error
+
+	// Get 获取一条消息，找不到时返回false
+	Get(target, messageId int64) (any, bool)
+}
+
+// SetMessageStore 设置消息存储，设置后会记录所有收到和发出的消息，
+// MessageFromId 会优先从本地获取，GroupRecallEvent 和 FriendRecallEvent 会带上原消息的内容。为nil表示不再记录
+func (b *Bot) SetMessageStore(s MessageStore) {
+	b.messageStore.Store(&s)
+}
+
+func (b *Bot) getMessageStore() MessageStore {
+	if s := b.messageStore.Load(); s != nil {
+		return *s
+	}
+	return nil
+}
+
+// messageKey 获取消息的target和messageId
+func messageKey(message any) (target int64, messageId int64, ok bool) {
+	var chain MessageChain
+	switch m := message.(type) {
+	case *FriendMessage:
+		target, chain = m.Sender.Id, m.MessageChain
+	case *GroupMessage:
+		target, chain = m.Sender.Group.Id, m.MessageChain
+	case *TempMessage:
+		target, chain = m.Sender.Id, m.MessageChain
+	case *StrangerMessage:
+		target, chain = m.Sender.Id, m.MessageChain
+	case *FriendSyncMessage:
+		target, chain = m.Subject.Id, m.MessageChain
+	case *GroupSyncMessage:
+		target, chain = m.Subject.Id, m.MessageChain
+	case *TempSyncMessage:
+		target, chain = m.Subject.Id, m.MessageChain
+	case *StrangerSyncMessage:
+		target, chain = m.Subject.Id, m.MessageChain
+	case *SentMessage:
+		target, chain = m.Target.Id, m.MessageChain
+	default:
+		return 0, 0, false
+	}
+	src := chain.Source()
+	if src == nil {
+		return 0, 0, false
+	}
+	return target, src.Id, true
+}
+
+// storeReceived 在读取消息的协程中调用，记录收到的消息，并给撤回事件带上原消息
+func (b *Bot) storeReceived(s MessageStore, event any) {
+	switch e := event.(type) {
+	case *GroupRecallEvent:
+		if m, ok := s.Get(e.Group.Id, e.MessageId); ok {
+			e.Origin = messageChainOf(m)
+		}
+	case *FriendRecallEvent:
+		target := e.AuthorId
+		if target == b.QQ {
+			target = e.Operator
+		}
+		if m, ok := s.Get(target, e.MessageId); ok {
+			e.Origin = messageChainOf(m)
+		}
+	default:
+		if target, messageId, ok := messageKey(event); ok {
+			if err := s.Put(target, messageId, event); err != nil {
+				slog.Error("store message failed", "error", err)
+			}
+		}
+	}
+}
+
+// SentMessage 通过 Bot 发出的消息，记录在 MessageStore 中，也会传给 Bot.OnMessageSent 注册的回调
+type SentMessage struct {
+	Target       Subject      `json:"target"`       // 消息发往的地方
+	MessageChain MessageChain `json:"messageChain"` // 消息链，第一个元素是 Source
+}
+
+// storeSent 记录发出的消息
+func (b *Bot) storeSent(message *SentMessage) {
+	target, messageId, ok := messageKey(message)
+	if !ok || messageId == 0 {
+		return
+	}
+	if s := b.getMessageStore(); s != nil {
+		if err := s.Put(target, messageId, message); err != nil {
+			slog.Error("store message failed", "error", err)
+		}
+	}
+	b.learnImageIds(target, messageId, message.MessageChain)
+	b.sentHookLock.RLock()
+	hooks := b.sentHooks
+	b.sentHookLock.RUnlock()
+	for _, f := range hooks {
+		f(message)
+	}
+}
+
+// OnMessageSent 注册发出消息后的回调。
+// 回调在发送消息的协程中同步执行，应当尽快返回
+func (b *Bot) OnMessageSent(f func(message *SentMessage)) {
+	b.sentHookLock.Lock()
+	defer b.sentHookLock.Unlock()
+	b.sentHooks = append(b.sentHooks[:len(b.sentHooks):len(b.sentHooks)], f)
+}
+
+// sentChain 给发出的消息链加上 Source ，时间取自 Bot 的 Clock
+func (b *Bot) sentChain(messageId int64, messageChain MessageChain) MessageChain {
+	ret := MessageChain{&Source{Type: "Source", Id: messageId, Time: b.Clock().Now().Unix()}}
+	return append(ret, messageChain.TrimSource()...)
+}
+
+func messageChainOf(message any) MessageChain {
+	switch m := message.(type) {
+	case *FriendMessage:
+		return m.MessageChain
+	case *GroupMessage:
+		return m.MessageChain
+	case *TempMessage:
+		return m.MessageChain
+	case *StrangerMessage:
+		return m.MessageChain
+	case *FriendSyncMessage:
+		return m.MessageChain
+	case *GroupSyncMessage:
+		return m.MessageChain
+	case *TempSyncMessage:
+		return m.MessageChain
+	case *StrangerSyncMessage:
+		return m.MessageChain
+	case *SentMessage:
+		return m.MessageChain
+	default:
+		return nil
+	}
+}
+
+type messageStoreKey struct {
+	target, messageId int64
+}
+
+// MemoryMessageStore 内存中的消息存储，超过容量时淘汰最久没有访问的消息
+type MemoryMessageStore struct {
+	capacity int
+	lock     sync.Mutex
+	list     *list.List
+	items    map[messageStoreKey]*list.Element
+}
+
+type memoryMessageStoreEntry struct {
+	key     messageStoreKey
+	message any
+}
+
+// NewMemoryMessageStore 新建一个内存中的消息存储，capacity-最多保存的消息数
+func NewMemoryMessageStore(capacity int) *MemoryMessageStore {
+	if capacity <= 0 {
+		capacity = 1
+	}
+	return &MemoryMessageStore{capacity: capacity, list: list.New(), items: make(map[messageStoreKey]*list.Element)}
+}
+
+func (s *MemoryMessageStore) Put(target, messageId int64, message any) error {
+	key := messageStoreKey{target, messageId}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if e, ok := s.items[key]; ok {
+		e.Value.(*memoryMessageStoreEntry).message = message
+		s.list.MoveToFront(e)
+		return nil
+	}
+	s.items[key] = s.list.PushFront(&memoryMessageStoreEntry{key: key, message: message})
+	for s.list.Len() > s.capacity {
+		e := s.list.Back()
+		s.list.Remove(e)
+		delete(s.items, e.Value.(*memoryMessageStoreEntry).key)
+	}
+	return nil
+}
+
+func (s *MemoryMessageStore) Get(target, messageId int64) (any, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	e, ok := s.items[messageStoreKey{target, messageId}]
+	if !ok {
+		return nil, false
+	}
+	s.list.MoveToFront(e)
+	return e.Value.(*memoryMessageStoreEntry).message, true
+}
+
+// FileMessageStore 用文件保存的消息存储，每条消息是文件中的一行json，内存中只保存每条消息在文件中的位置。
+//
+// 消息在后台协程中写入文件，还没写入时也能用 Get 获取。超过容量时淘汰最早写入的消息，
+// 文件中被淘汰或者被覆盖的行数超过容量时，会在后台重写文件。用完后需要调用 Close ，它会等待所有消息写入文件
+type FileMessageStore struct {
+	path     string
+	capacity int
+
+	lock    sync.RWMutex
+	f       *os.File
+	size    int64
+	lines   int // 文件中的行数，包括已经被淘汰或者被覆盖的
+	index   map[messageStoreKey]*fileMessagePos
+	order   *list.List // 按写入顺序排列的 messageStoreKey
+	pending map[messageStoreKey]*fileMessageWrite
+	queue   []*fileMessageWrite
+	notify  chan struct{}
+	done    chan struct{}
+	closed  bool
+}
+
+// maxFileMessageQueue 还没写入文件的消息数的上限，超过时 FileMessageStore.Put 返回错误
+const maxFileMessageQueue = 4096
+
+type fileMessagePos struct {
+	offset, length int64
+	elem           *list.Element // 在 FileMessageStore.order 中的位置
+}
+
+// fileMessageWrite 还没写入文件的一行，在 FileMessageStore.Put 中编码好，之后修改消息不会影响它
+type fileMessageWrite struct {
+	key  messageStoreKey
+	line []byte
+}
+
+type fileMessageRecord struct {
+	Target    int64           `json:"target"`
+	MessageId int64           `json:"messageId"`
+	Type      string          `json:"type"`
+	Message   json.RawMessage `json:"message"`
+}
+
+var storedMessageBuilder = map[string]func() any{
+	"FriendMessage":       func() any { return &FriendMessage{} },
+	"GroupMessage":        func() any { return &GroupMessage{} },
+	"TempMessage":         func() any { return &TempMessage{} },
+	"StrangerMessage":     func() any { return &StrangerMessage{} },
+	"FriendSyncMessage":   func() any { return &FriendSyncMessage{} },
+	"GroupSyncMessage":    func() any { return &GroupSyncMessage{} },
+	"TempSyncMessage":     func() any { return &TempSyncMessage{} },
+	"StrangerSyncMessage": func() any { return &StrangerSyncMessage{} },
+	"SentMessage":         func() any { return &SentMessage{} },
+}
+
+func storedMessageType(message any) string {
+	switch message.(type) {
+	case *FriendMessage:
+		return "FriendMessage"
+	case *GroupMessage:
+		return "GroupMessage"
+	case *TempMessage:
+		return "TempMessage"
+	case *StrangerMessage:
+		return "StrangerMessage"
+	case *FriendSyncMessage:
+		return "FriendSyncMessage"
+	case *GroupSyncMessage:
+		return "GroupSyncMessage"
+	case *TempSyncMessage:
+		return "TempSyncMessage"
+	case *StrangerSyncMessage:
+		return "StrangerSyncMessage"
+	case *SentMessage:
+		return "SentMessage"
+	default:
+		return ""
+	}
+}
+
+// OpenFileMessageStore 打开或者新建一个用文件保存的消息存储，会读取文件中已有的消息的位置。capacity-最多保存的消息数
+func OpenFileMessageStore(path string, capacity int) (*FileMessageStore, error) {
+	if capacity <= 0 {
+		capacity = 1
+	}
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	s := &FileMessageStore{
+		path:     path,
+		capacity: capacity,
+		f:        f,
+		index:    make(map[messageStoreKey]*fileMessagePos),
+		order:    list.New(),
+		pending:  make(map[messageStoreKey]*fileMessageWrite),
+		notify:   make(chan struct{}, 1),
+		done:     make(chan struct{}),
+	}
+	r := bufio.NewReader(f)
+	for {
+		line, err := r.ReadBytes('\n')
+		if len(line) > 0 && line[len(line)-1] == '\n' {
+			var record fileMessageRecord
+			if err := json.Unmarshal(line, &record); err == nil {
+				s.setPos(messageStoreKey{record.Target, record.MessageId}, s.size, int64(len(line)))
+			} else {
+				slog.Error("invalid message store record", "error", err)
+			}
+			s.size += int64(len(line))
+			s.lines++
+		}
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			_ = f.Close()
+			return nil, err
+		}
+	}
+	s.compactIfNeeded()
+	go s.loop()
+	return s, nil
+}
+
+// Put 在调用者的协程中编码消息并放入写入队列，写入失败时只会打印日志
+func (s *FileMessageStore) Put(target, messageId int64, message any) error {
+	if storedMessageType(message) == "" {
+		return fmt.Errorf("unsupported message type: %T", message)
+	}
+	buildMessageChain(messageChainOf(message))
+	key := messageStoreKey{target, messageId}
+	line, err := marshalFileMessage(key, message)
+	if err != nil {
+		return err
+	}
+	w := &fileMessageWrite{key, line}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.closed {
+		return errors.New("file message store is closed")
+	}
+	if len(s.queue) >= maxFileMessageQueue {
+		return errors.New("file message store queue is full")
+	}
+	s.queue = append(s.queue, w)
+	s.pending[key] = w
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+func (s *FileMessageStore) Get(target, messageId int64) (any, bool) {
+	key := messageStoreKey{target, messageId}
+	s.lock.RLock()
+	if w, ok := s.pending[key]; ok {
+		s.lock.RUnlock()
+		return unmarshalFileMessage(w.line)
+	}
+	pos, ok := s.index[key]
+	if !ok || s.f == nil {
+		s.lock.RUnlock()
+		return nil, false
+	}
+	line := make([]byte, pos.length)
+	_, err := s.f.ReadAt(line, pos.offset)
+	s.lock.RUnlock()
+	if err != nil {
+		slog.Error("read message store failed", "error", err)
+		return nil, false
+	}
+	return unmarshalFileMessage(line)
+}
+
+// unmarshalFileMessage 解码文件中的一行，每次都返回一个新的消息
+func unmarshalFileMessage(line []byte) (any, bool) {
+	var record fileMessageRecord
+	if err := json.Unmarshal(line, &record); err != nil {
+		slog.Error("invalid message store record", "error", err)
+		return nil, false
+	}
+	builder, ok := storedMessageBuilder[record.Type]
+	if !ok {
+		return nil, false
+	}
+	m := builder()
+	if err := json.Unmarshal(record.Message, m); err != nil {
+		slog.Error("invalid message store record", "error", err)
+		return nil, false
+	}
+	return m, true
+}
+
+// Close 等待所有消息写入文件后关闭文件
+func (s *FileMessageStore) Close() error {
+	s.lock.Lock()
+	if s.closed {
+		s.lock.Unlock()
+		return errors.New("file message store is already closed")
+	}
+	s.closed = true
+	close(s.notify)
+	s.lock.Unlock()
+	<-s.done
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	err := s.f.Close()
+	s.f = nil
+	return err
+}
+
+// loop 在后台把队列中的消息写入文件，直到 Close
+func (s *FileMessageStore) loop() {
+	defer close(s.done)
+	for range s.notify {
+		s.flush()
+	}
+	s.flush()
+}
+
+// flush 把队列中的消息写入文件
+func (s *FileMessageStore) flush() {
+	s.lock.Lock()
+	queue := s.queue
+	s.queue = nil
+	s.lock.Unlock()
+	if len(queue) == 0 {
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for _, w := range queue {
+		if s.pending[w.key] == w {
+			delete(s.pending, w.key)
+		}
+		if _, err := s.f.WriteAt(w.line, s.size); err != nil {
+			slog.Error("store message failed", "error", err)
+			continue
+		}
+		s.setPos(w.key, s.size, int64(len(w.line)))
+		s.size += int64(len(w.line))
+		s.lines++
+	}
+	s.compactIfNeeded()
+}
+
+func marshalFileMessage(key messageStoreKey, message any) ([]byte, error) {
+	buf, err := json.Marshal(message)
+	if err != nil {
+		return nil, err
+	}
+	line, err := json.Marshal(&fileMessageRecord{Target: key.target, MessageId: key.messageId, Type: storedMessageType(message), Message: buf})
+	if err != nil {
+		return nil, err
+	}
+	return append(line, '\n'), nil
+}
+
+// setPos 记录消息在文件中的位置，超过容量时淘汰最早写入的消息，调用时需要持有写锁
+func (s *FileMessageStore) setPos(key messageStoreKey, offset, length int64) {
+	if pos, ok := s.index[key]; ok {
+		s.order.Remove(pos.elem)
+	}
+	s.index[key] = &fileMessagePos{offset: offset, length: length, elem: s.order.PushBack(key)}
+	for len(s.index) > s.capacity {
+		e := s.order.Front()
+		s.order.Remove(e)
+		delete(s.index, e.Value.(messageStoreKey))
+	}
+}
+
+// compactIfNeeded 文件中无效的行数超过容量时，只保留有效的行重写文件，调用时需要持有写锁
+func (s *FileMessageStore) compactIfNeeded() {
+	if s.lines-len(s.index) <= s.capacity {
+		return
+	}
+	if err := s.compact(); err != nil {
+		slog.Error("compact message store failed", "error", err)
+	}
+}
+
+func (s *FileMessageStore) compact() error {
+	tmpPath := s.path + ".tmp"
+	tmp, err := os.OpenFile(tmpPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	fail := func(err error) error {
+		_ = tmp.Close()
+		_ = os.Remove(tmpPath)
+		return err
+	}
+	offsets := make([]int64, 0, len(s.index))
+	var size int64
+	for e := s.order.Front(); e != nil; e = e.Next() {
+		pos := s.index[e.Value.(messageStoreKey)]
+		line := make([]byte, pos.length)
+		if _, err := s.f.ReadAt(line, pos.offset); err != nil {
+			return fail(err)
+		}
+		if _, err := tmp.WriteAt(line, size); err != nil {
+			return fail(err)
+		}
+		offsets = append(offsets, size)
+		size += pos.length
+	}
+	if err := os.Rename(tmpPath, s.path); err != nil {
+		return fail(err)
+	}
+	_ = s.f.Close()
+	s.f, s.size, s.lines = tmp, size, len(s.index)
+	i := 0
+	for e := s.order.Front(); e != nil; e = e.Next() {
+		s.index[e.Value.(messageStoreKey)].offset = offsets[i]
+		i++
+	}
+	return nil
+}
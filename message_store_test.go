@@ -0,0 +1,134 @@
+package miraihttp
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestMemoryMessageStore(t *testing.T) {
+	s := NewMemoryMessageStore(2)
+	assert.Nil(t, s.Put(1, 1, "a"))
+	assert.Nil(t, s.Put(1, 2, "b"))
+	_, ok := s.Get(1, 1)
+	assert.True(t, ok)
+	assert.Nil(t, s.Put(1, 3, "c"))
+	_, ok = s.Get(1, 2)
+	assert.False(t, ok)
+	m, ok := s.Get(1, 1)
+	assert.True(t, ok)
+	assert.Equal(t, "a", m)
+}
+
+func TestFileMessageStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "messages.jsonl")
+	s, err := OpenFileMessageStore(path, 100)
+	assert.Nil(t, err)
+	message := &GroupMessage{
+		Sender:       Member{Id: 2, MemberName: "a", Group: Group{Id: 1}},
+		MessageChain: MessageChain{&Source{Type: "Source", Id: 3, Time: 4}, &Plain{Type: "Plain", Text: "hi"}},
+	}
+	assert.Nil(t, s.Put(1, 3, message))
+	assert.NotNil(t, s.Put(1, 4, "unsupported"))
+	assert.Nil(t, s.Close())
+
+	s, err = OpenFileMessageStore(path, 100)
+	assert.Nil(t, err)
+	defer func() { _ = s.Close() }()
+	m, ok := s.Get(1, 3)
+	assert.True(t, ok)
+	assert.Equal(t, message, m)
+
+	b := newBot(10)
+	b.storeReceived(s, &FriendMessage{Sender: Friend{Id: 5}, MessageChain: MessageChain{&Source{Id: 6}, &Plain{Text: "x"}}})
+	recall := &FriendRecallEvent{AuthorId: 5, MessageId: 6, Operator: 5}
+	b.storeReceived(s, recall)
+	assert.Equal(t, "x", recall.Origin.PlainText())
+
+	// 放入之后修改消息不影响保存的内容
+	edited := &FriendMessage{Sender: Friend{Id: 7}, MessageChain: MessageChain{&Source{Type: "Source", Id: 8}, &Plain{Type: "Plain", Text: "before"}}}
+	assert.Nil(t, s.Put(7, 8, edited))
+	edited.MessageChain[1].(*Plain).Text = "after"
+	m, ok = s.Get(7, 8)
+	assert.True(t, ok)
+	assert.Equal(t, "before", messageChainOf(m).PlainText())
+}
+
+func TestFileMessageStoreCapacity(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "messages.jsonl")
+	s, err := OpenFileMessageStore(path, 2)
+	require.Nil(t, err)
+	for i := int64(1); i <= 10; i++ {
+		assert.Nil(t, s.Put(1, i, &FriendMessage{Sender: Friend{Id: 1}, MessageChain: MessageChain{&Source{Id: i}}}))
+	}
+	// Get和Close同时调用
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			s.Get(1, 10)
+		}
+	}()
+	assert.Nil(t, s.Close())
+	wg.Wait()
+	_, ok := s.Get(1, 10)
+	assert.False(t, ok)
+	assert.NotNil(t, s.Put(1, 11, &FriendMessage{}))
+
+	// 超过容量的消息被淘汰，并且文件被重写过
+	buf, err := os.ReadFile(path)
+	require.Nil(t, err)
+	assert.LessOrEqual(t, bytes.Count(buf, []byte("\n")), 4)
+	s, err = OpenFileMessageStore(path, 2)
+	require.Nil(t, err)
+	defer func() { _ = s.Close() }()
+	_, ok = s.Get(1, 8)
+	assert.False(t, ok)
+	for _, id := range []int64{9, 10} {
+		m, ok := s.Get(1, id)
+		assert.True(t, ok)
+		assert.Equal(t, id, m.(*FriendMessage).MessageChain.Source().Id)
+	}
+}
+
+func TestStoreSent(t *testing.T) {
+	s, b := newTestBot(t, nil)
+	b.SetMessageStore(NewMemoryMessageStore(16))
+	var hooked *SentMessage
+	b.OnMessageSent(func(message *SentMessage) { hooked = message })
+	id, err := b.SendTempMessage(2, 3, 0, MessageChain{&Plain{Text: "hi"}})
+	require.Nil(t, err)
+	m, err := b.MessageFromId(id, 2)
+	require.Nil(t, err)
+	sent, ok := m.(*SentMessage)
+	require.True(t, ok)
+	assert.Same(t, hooked, sent)
+	assert.Equal(t, Subject{Kind: KindTemp, Id: 2, Group: 3}, sent.ReplyTo())
+	assert.Equal(t, "hi", sent.MessageChain.PlainText())
+
+	// 回复发出的消息时发往原来的地方，而不是Bot自己
+	_, err = sent.QuoteReply(b, MessageChain{&Plain{Text: "again"}})
+	require.Nil(t, err)
+	req := s.Last()
+	assert.Equal(t, "sendTempMessage", req.Command)
+	assert.Equal(t, int64(2), req.Content.Get("qq").Int())
+	assert.Equal(t, int64(3), req.Content.Get("group").Int())
+	assert.Equal(t, id, req.Content.Get("quote").Int())
+
+	// 文件中也能保存发出的消息
+	fs, err := OpenFileMessageStore(filepath.Join(t.TempDir(), "messages.jsonl"), 10)
+	require.Nil(t, err)
+	assert.Nil(t, fs.Put(2, id, sent))
+	assert.Nil(t, fs.Close())
+	fs, err = OpenFileMessageStore(fs.path, 10)
+	require.Nil(t, err)
+	defer func() { _ = fs.Close() }()
+	m, ok = fs.Get(2, id)
+	assert.True(t, ok)
+	assert.Equal(t, sent, m)
+}
@@ -2,6 +2,7 @@ package miraihttp
 
 import (
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/tidwall/gjson"
 	"testing"
 )
@@ -18,3 +19,172 @@ func TestMessageChain(t *testing.T) {
 		MessageChain{&Plain{Text: "123"}, &Poke{Name: "SixSixSix"}, &Image{ImageId: "1", Url: "url"}},
 	))
 }
+
+func TestChainBuilder(t *testing.T) {
+	chain, err := NewChain().Text("hi ").Textf("%d", 1).Newline().At(123).Face("微笑").Quote(&Source{Id: 5}).Build()
+	assert.Nil(t, err)
+	assert.Equal(t, MessageChain{
+		&Plain{Type: "Plain", Text: "hi 1\n"},
+		&At{Type: "At", Target: 123},
+		&Face{Type: "Face", Name: "微笑"},
+		&Quote{Type: "Quote", Id: 5, fromBuilder: true},
+	}, chain)
+	quote, chain := extractQuote(0, chain)
+	assert.Equal(t, int64(5), quote)
+	assert.Len(t, chain, 3)
+
+	// 收到的消息链中的引用回复不会被提取
+	received := MessageChain{&Quote{Type: "Quote", Id: 6}, &Plain{Type: "Plain", Text: "a"}}
+	quote, chain = extractQuote(0, received)
+	assert.Zero(t, quote)
+	assert.Equal(t, received, chain)
+
+	// Append 不修改传入的消息，并且同样只允许一条引用回复
+	at := &At{Target: 1}
+	chain, err = NewChain().Append(at, &Quote{Id: 6, Origin: MessageChain{&Plain{Text: "o"}}}).Build()
+	assert.Nil(t, err)
+	assert.Empty(t, at.Type)
+	assert.Equal(t, MessageChain{&At{Type: "At", Target: 1}, &Quote{Type: "Quote", Id: 6, fromBuilder: true}}, chain)
+	_, err = NewChain().Quote(&Source{Id: 1}).Append(&Quote{Id: 2}).Build()
+	assert.NotNil(t, err)
+
+	_, err = NewChain().Text("a").Append(&MarketFace{Id: 1}).Build()
+	assert.NotNil(t, err)
+	_, err = NewChain().Build()
+	assert.NotNil(t, err)
+}
+
+func TestMessageChainQuery(t *testing.T) {
+	chain := MessageChain{&Source{Id: 1}, &Plain{Text: "a"}, &At{Target: 2}, &Image{ImageId: "i"}, &Plain{Text: "b"}, &At{Target: 3}}
+	assert.Equal(t, "ab", chain.PlainText())
+	assert.Equal(t, "a@2[图片]b@3", chain.String())
+	assert.Equal(t, int64(1), chain.Source().Id)
+	assert.Nil(t, chain.Quote())
+	assert.Equal(t, []int64{2, 3}, chain.Ats())
+	assert.True(t, chain.IsAtBot(3))
+	assert.False(t, chain.IsAtBot(4))
+	assert.Len(t, chain.Images(), 1)
+	assert.Len(t, chain.TrimSource(), 5)
+	at, ok := First[*At](chain)
+	assert.True(t, ok)
+	assert.Equal(t, int64(2), at.Target)
+}
+
+func TestNestedMessageChain(t *testing.T) {
+	content := `[{"type":"Quote","id":1,"groupId":2,"senderId":3,"targetId":2,"origin":[{"type":"Plain","text":"q"}]},` +
+		`{"type":"Forward","display":{"title":"t","preview":["a","b"]},"nodeList":[{"senderId":3,"time":4,"senderName":"n","messageChain":[` +
+		`{"type":"Forward","nodeList":[{"senderId":5,"messageChain":[{"type":"At","target":6}]}]}]}]}]`
+	chain := parseMessageChain(gjson.Parse(content).Array())
+	assert.Equal(t, MessageChain{&Plain{Type: "Plain", Text: "q"}}, chain.Quote().Origin)
+	forward, ok := First[*ForwardMessage](chain)
+	assert.True(t, ok)
+	assert.Equal(t, &ForwardDisplay{Title: "t", Preview: []string{"a", "b"}}, forward.Display)
+	inner, ok := First[*ForwardMessage](forward.NodeList[0].MessageChain)
+	assert.True(t, ok)
+	assert.Equal(t, MessageChain{&At{Type: "At", Target: 6}}, inner.NodeList[0].MessageChain)
+
+	built := buildMessageChain(MessageChain{&ForwardMessage{NodeList: []*ForwardMessageNode{{MessageChain: MessageChain{&Plain{Text: "x"}}}}}})
+	assert.Equal(t, "Plain", built[0].(*ForwardMessage).NodeList[0].MessageChain[0].(*Plain).Type)
+}
+
+func TestForwardBuilder(t *testing.T) {
+	group := &GroupMessage{Sender: Member{Id: 1, MemberName: "a"}, MessageChain: MessageChain{&Source{Id: 9, Time: 100}, &Plain{Text: "hi"}}}
+	inner, err := NewForward().AddMessageId(3).Build()
+	assert.Nil(t, err)
+	forward, err := NewForward().Display(&ForwardDisplay{Title: "t"}).AddGroupMessage(group).AddMessageRef(4, 5).AddForward(2, "b", 200, inner).Build()
+	assert.Nil(t, err)
+	assert.Equal(t, "Forward", forward.Type)
+	assert.Equal(t, &ForwardMessageNode{SenderId: 1, Time: 100, SenderName: "a", MessageChain: MessageChain{&Plain{Type: "Plain", Text: "hi"}}}, forward.NodeList[0])
+	assert.Len(t, forward.NodeList, 3)
+
+	_, err = NewForward().Build()
+	assert.NotNil(t, err)
+	bad := &ForwardMessage{NodeList: []*ForwardMessageNode{{MessageId: 1, MessageRef: &MessageRef{MessageId: 1, Target: 2}}}}
+	assert.NotNil(t, bad.Validate())
+	nested := &ForwardMessage{NodeList: []*ForwardMessageNode{{SenderId: 1, MessageChain: MessageChain{&ForwardMessage{}}}}}
+	assert.NotNil(t, nested.Validate())
+}
+
+func TestSplitMessageChain(t *testing.T) {
+	chain := MessageChain{&Source{Id: 1}, &At{Target: 1}, &Plain{Text: "一二三\n四五六七八九十"}}
+	assert.Equal(t, 13, MessageLength(chain))
+	assert.Equal(t, []MessageChain{
+		{&At{Target: 1}, &Plain{Type: "Plain", Text: "一二三\n"}},
+		{&Plain{Type: "Plain", Text: "四五六七八九"}},
+		{&Plain{Type: "Plain", Text: "十"}},
+	}, SplitMessageChain(chain, 6))
+	assert.Len(t, SplitMessageChain(chain, 0), 1)
+
+	// 需要拆分时，At 和 Quote 都放在第一条消息的开头
+	chain = MessageChain{&Plain{Text: "一二三四五"}, &At{Target: 2}, &Quote{Id: 3}, &Plain{Text: "六七"}}
+	assert.Equal(t, []MessageChain{
+		{&At{Target: 2}, &Quote{Id: 3}, &Plain{Type: "Plain", Text: "一二三四"}},
+		{&Plain{Type: "Plain", Text: "五"}, &Plain{Type: "Plain", Text: "六七"}},
+	}, SplitMessageChain(chain, 6))
+	// 不需要拆分时保持原样
+	assert.Equal(t, []MessageChain{chain}, SplitMessageChain(chain, 10))
+}
+
+func TestSendLongMessage(t *testing.T) {
+	s, b := newTestBot(t, nil)
+	chain, err := NewChain().Quote(&Source{Id: 9}).Text("一二三\n四五六七八九十").At(2).Build()
+	assert.NoError(t, err)
+
+	ids, err := b.SendLongMessage(Subject{Kind: KindGroup, Id: 100}, 0, chain, SplitOption{MaxLength: 6})
+	assert.NoError(t, err)
+	requests := s.Requests("sendGroupMessage")
+	assert.Len(t, requests, 3)
+	assert.Equal(t, []int64{1, 2, 3}, ids)
+	for i, req := range requests {
+		assert.Equal(t, int64(100), req.Content.Get("target").Int())
+		if i == 0 {
+			assert.Equal(t, int64(9), req.Content.Get("quote").Int())
+			assert.Equal(t, "At", req.Content.Get("messageChain.0.type").String())
+			assert.Equal(t, int64(2), req.Content.Get("messageChain.0.target").Int())
+		} else {
+			assert.False(t, req.Content.Get("quote").Exists())
+		}
+		for _, m := range req.Content.Get("messageChain").Array() {
+			assert.NotEqual(t, "Quote", m.Get("type").String())
+		}
+	}
+
+	s.Reset()
+	ids, err = b.SendLongMessage(Subject{Kind: KindGroup, Id: 100}, 0, chain, SplitOption{Mode: SplitModeForward, MaxLength: 6, SenderName: "bot"})
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{1, 2}, ids)
+	requests = s.Requests("sendGroupMessage")
+	require.Len(t, requests, 2)
+	// At 和 Quote 在转发消息之前单独发送
+	assert.Equal(t, int64(9), requests[0].Content.Get("quote").Int())
+	assert.Len(t, requests[0].Content.Get("messageChain").Array(), 1)
+	assert.Equal(t, "At", requests[0].Content.Get("messageChain.0.type").String())
+	assert.False(t, requests[1].Content.Get("quote").Exists())
+	assert.Equal(t, "Forward", requests[1].Content.Get("messageChain.0.type").String())
+	nodes := requests[1].Content.Get("messageChain.0.nodeList").Array()
+	assert.Len(t, nodes, 2)
+	for _, node := range nodes {
+		for _, m := range node.Get("messageChain").Array() {
+			assert.Equal(t, "Plain", m.Get("type").String())
+		}
+	}
+
+	// 没有 At 和 Quote 时只发送转发消息
+	s.Reset()
+	ids, err = b.SendLongMessage(Subject{Kind: KindFriend, Id: 1}, 7, MessageChain{&Plain{Text: "一二三四五六七八九十"}}, SplitOption{Mode: SplitModeForward, MaxLength: 6})
+	assert.NoError(t, err)
+	assert.Len(t, ids, 1)
+	req := s.Last()
+	assert.Equal(t, "sendFriendMessage", req.Command)
+	assert.Equal(t, int64(7), req.Content.Get("quote").Int())
+	assert.Equal(t, "Forward", req.Content.Get("messageChain.0.type").String())
+	assert.Len(t, req.Content.Get("messageChain.0.nodeList").Array(), 2)
+
+	s.Reset()
+	ids, err = b.SendLongMessage(Subject{Kind: KindFriend, Id: 1}, 5, MessageChain{&Plain{Text: "short"}}, SplitOption{})
+	assert.NoError(t, err)
+	assert.Len(t, ids, 1)
+	assert.Equal(t, int64(5), s.Last().Content.Get("quote").Int())
+	_, err = b.SendLongMessage(Subject{Kind: KindFriend, Id: 1}, 0, nil, SplitOption{})
+	assert.Error(t, err)
+}
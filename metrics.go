@@ -0,0 +1,76 @@
+package miraihttp
+
+import (
+	"time"
+)
+
+// 事件被丢弃的原因，见 Metrics.EventDropped
+const (
+	DropReasonNoHandler    = "no_handler"    // 没有监听这种事件
+	DropReasonUnknownType  = "unknown_type"  // 不认识的事件类型
+	DropReasonDecodeFailed = "decode_failed" // 解析失败
+)
+
+// Metrics 运行指标的收集接口，用 Bot.SetMetrics 设置，可以使用内置的 PrometheusMetrics 。
+//
+// 方法会在读取消息的协程、处理事件的协程和发送请求的协程中调用，实现时需要注意并发安全，并且不能阻塞。
+// 事件队列中的事件数、正在等待返回的请求数等当前值可以通过 Bot.EventStats 和 Bot.PendingRequests 获取。
+type Metrics interface {
+	// RequestDone 一次请求结束，err为nil表示成功
+	RequestDone(command, subCommand string, duration time.Duration, err error)
+
+	// LimiterRejected 请求被限流器拒绝
+	LimiterRejected(command, subCommand string)
+
+	// EventReceived 收到一条消息或事件
+	EventReceived(eventType string)
+
+	// EventDecoded 一条消息或事件解析成功
+	EventDecoded(eventType string)
+
+	// EventDropped 一条消息或事件没有被处理，reason是 DropReasonNoHandler 等。因为队列满了而丢弃的事件见 EventStats.Dropped
+	EventDropped(eventType, reason string)
+
+	// HandlerDone 一个监听函数执行结束，panicked表示是否发生了panic。超时的监听函数会在真正执行结束后才调用
+	HandlerDone(eventType string, duration time.Duration, panicked bool)
+
+	// Disconnected 与mirai-api-http的连接断开。本库不会自动重连，断开的次数即调用者需要重连的次数
+	Disconnected()
+}
+
+type noopMetrics struct{}
+
+func (noopMetrics) RequestDone(string, string, time.Duration, error) {}
+
+func (noopMetrics) LimiterRejected(string, string) {}
+
+func (noopMetrics) EventReceived(string) {}
+
+func (noopMetrics) EventDecoded(string) {}
+
+func (noopMetrics) EventDropped(string, string) {}
+
+func (noopMetrics) HandlerDone(string, time.Duration, bool) {}
+
+func (noopMetrics) Disconnected() {}
+
+// SetMetrics 设置运行指标的收集接口，为nil表示不收集
+func (b *Bot) SetMetrics(m Metrics) {
+	if m == nil {
+		b.metrics.Store(nil)
+		return
+	}
+	b.metrics.Store(&m)
+}
+
+func (b *Bot) getMetrics() Metrics {
+	if m := b.metrics.Load(); m != nil {
+		return *m
+	}
+	return noopMetrics{}
+}
+
+// PendingRequests 已经发出、正在等待返回的请求数
+func (b *Bot) PendingRequests() int64 {
+	return b.pending.Load()
+}
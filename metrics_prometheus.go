@@ -0,0 +1,261 @@
+package miraihttp
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultPrometheusBuckets 返回 PrometheusMetrics 中耗时直方图默认的分桶，单位为秒
+func DefaultPrometheusBuckets() []float64 {
+	return []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+}
+
+type histogram struct {
+	counts []uint64 // 每个分桶的数量，不是累计值，与 PrometheusMetrics.buckets 一一对应
+	count  uint64
+	sum    float64
+}
+
+func (h *histogram) observe(buckets []float64, d time.Duration) {
+	if h.counts == nil {
+		h.counts = make([]uint64, len(buckets))
+	}
+	v := d.Seconds()
+	if i, _ := slices.BinarySearch(buckets, v); i < len(h.counts) {
+		h.counts[i]++
+	}
+	h.count++
+	h.sum += v
+}
+
+// PrometheusMetrics 内置的 Metrics 实现，用 Handler 以Prometheus的文本格式输出，例如：
+//
+//	m := miraihttp.NewPrometheusMetrics()
+//	b.SetMetrics(m)
+//	http.Handle("/metrics", m.Handler(b))
+type PrometheusMetrics struct {
+	buckets         []float64 // 耗时直方图的分桶，创建后不再改变
+	lock            sync.Mutex
+	requests        map[[2]string]*histogram
+	requestErrors   map[[2]string]uint64
+	limiterRejected map[[2]string]uint64
+	received        map[string]uint64
+	decoded         map[string]uint64
+	dropped         map[[2]string]uint64
+	handlers        map[string]*histogram
+	panics          map[string]uint64
+	disconnects     uint64
+}
+
+// NewPrometheusMetrics 新建一个 PrometheusMetrics ，buckets是耗时直方图的分桶，单位为秒，
+// 为空时使用 DefaultPrometheusBuckets 。buckets会被复制并排序，之后修改它不会影响输出
+func NewPrometheusMetrics(buckets ...float64) *PrometheusMetrics {
+	if len(buckets) == 0 {
+		buckets = DefaultPrometheusBuckets()
+	} else {
+		buckets = slices.Clone(buckets)
+	}
+	slices.Sort(buckets)
+	return &PrometheusMetrics{
+		buckets:         slices.Compact(buckets),
+		requests:        make(map[[2]string]*histogram),
+		requestErrors:   make(map[[2]string]uint64),
+		limiterRejected: make(map[[2]string]uint64),
+		received:        make(map[string]uint64),
+		decoded:         make(map[string]uint64),
+		dropped:         make(map[[2]string]uint64),
+		handlers:        make(map[string]*histogram),
+		panics:          make(map[string]uint64),
+	}
+}
+
+func (p *PrometheusMetrics) RequestDone(command, subCommand string, duration time.Duration, err error) {
+	key := [2]string{command, subCommand}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	h := p.requests[key]
+	if h == nil {
+		h = &histogram{}
+		p.requests[key] = h
+	}
+	h.observe(p.buckets, duration)
+	if err != nil {
+		p.requestErrors[key]++
+	}
+}
+
+func (p *PrometheusMetrics) LimiterRejected(command, subCommand string) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.limiterRejected[[2]string{command, subCommand}]++
+}
+
+func (p *PrometheusMetrics) EventReceived(eventType string) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.received[eventType]++
+}
+
+func (p *PrometheusMetrics) EventDecoded(eventType string) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.decoded[eventType]++
+}
+
+func (p *PrometheusMetrics) EventDropped(eventType, reason string) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.dropped[[2]string{eventType, reason}]++
+}
+
+func (p *PrometheusMetrics) HandlerDone(eventType string, duration time.Duration, panicked bool) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	h := p.handlers[eventType]
+	if h == nil {
+		h = &histogram{}
+		p.handlers[eventType] = h
+	}
+	h.observe(p.buckets, duration)
+	if panicked {
+		p.panics[eventType]++
+	}
+}
+
+func (p *PrometheusMetrics) Disconnected() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.disconnects++
+}
+
+// Handler 返回输出指标的 http.Handler 。b不为nil时，还会输出b的事件队列和正在等待返回的请求数等当前值
+func (p *PrometheusMetrics) Handler(b *Bot) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		bw := bufio.NewWriter(w)
+		p.Write(bw, b)
+		_ = bw.Flush()
+	})
+}
+
+// Write 以Prometheus的文本格式输出所有指标，b的含义同 Handler
+func (p *PrometheusMetrics) Write(w io.Writer, b *Bot) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	requestLabels := func(key [2]string) string {
+		return labels("command", key[0], "sub_command", key[1])
+	}
+	header(w, "mirai_requests_total", "counter", "请求总数")
+	writeCounters(w, "mirai_requests_total", p.requests, requestLabels, func(h *histogram) uint64 { return h.count })
+	header(w, "mirai_request_errors_total", "counter", "失败的请求总数，包括超时和返回码不为0")
+	writeCounters(w, "mirai_request_errors_total", p.requestErrors, requestLabels, nil)
+	header(w, "mirai_request_duration_seconds", "histogram", "请求的耗时")
+	writeHistograms(w, "mirai_request_duration_seconds", p.buckets, p.requests, requestLabels)
+	header(w, "mirai_limiter_rejected_total", "counter", "被限流器拒绝的请求总数")
+	writeCounters(w, "mirai_limiter_rejected_total", p.limiterRejected, requestLabels, nil)
+
+	typeLabels := func(key string) string { return labels("type", key) }
+	header(w, "mirai_events_received_total", "counter", "收到的消息和事件总数")
+	writeCounters(w, "mirai_events_received_total", p.received, typeLabels, nil)
+	header(w, "mirai_events_decoded_total", "counter", "解析成功的消息和事件总数")
+	writeCounters(w, "mirai_events_decoded_total", p.decoded, typeLabels, nil)
+	header(w, "mirai_events_dropped_total", "counter", "没有处理的消息和事件总数")
+	writeCounters(w, "mirai_events_dropped_total", p.dropped, func(key [2]string) string {
+		return labels("type", key[0], "reason", key[1])
+	}, nil)
+	header(w, "mirai_handler_duration_seconds", "histogram", "监听函数的耗时")
+	writeHistograms(w, "mirai_handler_duration_seconds", p.buckets, p.handlers, typeLabels)
+	header(w, "mirai_handler_panics_total", "counter", "监听函数发生panic的总数")
+	writeCounters(w, "mirai_handler_panics_total", p.panics, typeLabels, nil)
+
+	header(w, "mirai_disconnects_total", "counter", "连接断开的次数")
+	_, _ = fmt.Fprintf(w, "mirai_disconnects_total %d\n", p.disconnects)
+
+	if b == nil {
+		return
+	}
+	s := b.EventStats()
+	for _, g := range []struct {
+		name, typ, help string
+		value           int64
+	}{
+		{"mirai_pending_requests", "gauge", "正在等待返回的请求数", b.PendingRequests()},
+		{"mirai_event_queue_depth", "gauge", "在队列中等待处理的事件数", s.Queued},
+		{"mirai_events_running", "gauge", "正在处理的事件数", s.Running},
+		{"mirai_events_waiting", "gauge", "正在等待下一条消息的协程数", s.Waiting},
+		{"mirai_events_parked", "gauge", "监听函数正在等待下一条消息的事件数", s.Parked},
+		{"mirai_events_processed_total", "counter", "处理完的事件总数", s.Processed},
+		{"mirai_events_queue_dropped_total", "counter", "因为队列满了而丢弃的事件总数", s.Dropped},
+		{"mirai_handler_timeouts_total", "counter", "执行超时的监听函数总数", s.TimedOut},
+	} {
+		header(w, g.name, g.typ, g.help)
+		_, _ = fmt.Fprintf(w, "%s %d\n", g.name, g.value)
+	}
+}
+
+func header(w io.Writer, name, typ, help string) {
+	_, _ = fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+// labels 输出标签，参数为 名称1, 值1, 名称2, 值2...
+func labels(kv ...string) string {
+	var sb strings.Builder
+	sb.WriteByte('{')
+	for i := 0; i < len(kv); i += 2 {
+		if i > 0 {
+			sb.WriteByte(',')
+		}
+		sb.WriteString(kv[i])
+		sb.WriteString(`="`)
+		sb.WriteString(strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(kv[i+1]))
+		sb.WriteByte('"')
+	}
+	sb.WriteByte('}')
+	return sb.String()
+}
+
+func sortedKeys[K [2]string | string, V any](m map[K]V) []K {
+	keys := make([]K, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.SortFunc(keys, func(a, b K) int {
+		return strings.Compare(fmt.Sprint(a), fmt.Sprint(b))
+	})
+	return keys
+}
+
+// writeCounters 输出计数器，value为nil时m的值就是计数
+func writeCounters[K [2]string | string, V any](w io.Writer, name string, m map[K]V, label func(K) string, value func(V) uint64) {
+	for _, k := range sortedKeys(m) {
+		v := any(m[k])
+		if value != nil {
+			v = value(m[k])
+		}
+		_, _ = fmt.Fprintf(w, "%s%s %d\n", name, label(k), v)
+	}
+}
+
+func writeHistograms[K [2]string | string](w io.Writer, name string, buckets []float64, m map[K]*histogram, label func(K) string) {
+	for _, k := range sortedKeys(m) {
+		h, l := m[k], label(k)
+		var cumulative uint64
+		for i, le := range buckets {
+			if i < len(h.counts) {
+				cumulative += h.counts[i]
+			}
+			_, _ = fmt.Fprintf(w, "%s_bucket%s,le=\"%s\"} %d\n", name, l[:len(l)-1], strconv.FormatFloat(le, 'g', -1, 64), cumulative)
+		}
+		_, _ = fmt.Fprintf(w, "%s_bucket%s,le=\"+Inf\"} %d\n", name, l[:len(l)-1], h.count)
+		_, _ = fmt.Fprintf(w, "%s_sum%s %s\n", name, l, strconv.FormatFloat(h.sum, 'g', -1, 64))
+		_, _ = fmt.Fprintf(w, "%s_count%s %d\n", name, l, h.count)
+	}
+}
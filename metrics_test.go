@@ -0,0 +1,76 @@
+package miraihttp
+
+import (
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/time/rate"
+	"log/slog"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPrometheusMetrics(t *testing.T) {
+	_, b := newTestBot(t, nil)
+	m := NewPrometheusMetrics()
+	b.SetMetrics(m)
+	b.ListenGroupMessage(func(*GroupMessage) bool {
+		panic("test")
+	})
+
+	groupMessage := `{"syncId":"-1","data":` + string(readFixture(t, "events", "GroupMessage")) + `}`
+	b.handleFrame(slog.Default(), []byte(groupMessage))
+	b.handleFrame(slog.Default(), []byte(`{"syncId":"-1","data":{"type":"FriendMessage"}}`))
+	done := make(chan struct{})
+	b.Run(func() { close(done) })
+	<-done
+
+	_, err := b.GroupFiles(100).ReadDir("")
+	assert.NoError(t, err)
+	b.SetLimiter("drop", rate.NewLimiter(0, 0))
+	_, err = b.GroupFiles(100).ReadDir("")
+	assert.Error(t, err)
+	assert.Zero(t, b.PendingRequests())
+
+	w := httptest.NewRecorder()
+	m.Handler(b).ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	body := w.Body.String()
+	for _, line := range []string{
+		`mirai_requests_total{command="file_list",sub_command=""} 1`,
+		`mirai_request_duration_seconds_count{command="file_list",sub_command=""} 1`,
+		`mirai_request_duration_seconds_bucket{command="file_list",sub_command="",le="+Inf"} 1`,
+		`mirai_limiter_rejected_total{command="file_list",sub_command=""} 1`,
+		`mirai_events_received_total{type="GroupMessage"} 1`,
+		`mirai_events_received_total{type="FriendMessage"} 1`,
+		`mirai_events_decoded_total{type="GroupMessage"} 1`,
+		`mirai_events_dropped_total{type="FriendMessage",reason="no_handler"} 1`,
+		`mirai_handler_duration_seconds_count{type="GroupMessage"} 1`,
+		`mirai_handler_panics_total{type="GroupMessage"} 1`,
+		`mirai_pending_requests 0`,
+		`mirai_event_queue_depth 0`,
+		`mirai_events_processed_total 2`,
+	} {
+		assert.Contains(t, body, line)
+	}
+	assert.NotContains(t, body, `mirai_request_errors_total{command="file_list",sub_command=""} 1`)
+}
+
+func TestPrometheusLabels(t *testing.T) {
+	assert.Equal(t, `{a="x\"y\\z\n",b=""}`, labels("a", "x\"y\\z\n", "b", ""))
+}
+
+func TestPrometheusBuckets(t *testing.T) {
+	buckets := []float64{2, 1}
+	m := NewPrometheusMetrics(buckets...)
+	buckets[0] = 100
+	m.HandlerDone("GroupMessage", 1500*time.Millisecond, false)
+	var w strings.Builder
+	writeHistograms(&w, "h", m.buckets, m.handlers, func(key string) string { return labels("type", key) })
+	assert.Equal(t, `h_bucket{type="GroupMessage",le="1"} 0
+h_bucket{type="GroupMessage",le="2"} 1
+h_bucket{type="GroupMessage",le="+Inf"} 1
+h_sum{type="GroupMessage"} 1.5
+h_count{type="GroupMessage"} 1
+`, w.String())
+	assert.Equal(t, DefaultPrometheusBuckets(), NewPrometheusMetrics().buckets)
+}
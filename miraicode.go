@@ -0,0 +1,275 @@
+package miraihttp
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const miraiCodePrefix = "[mirai:"
+
+// pokeMiraiCode 戳一戳在MiraiCode中的表示，格式为 名称,类型,id
+var pokeMiraiCode = map[PokeName]string{
+	PokeNamePoke:        "戳一戳,1,-1",
+	PokeNameShowLove:    "比心,2,-1",
+	PokeNameLike:        "点赞,3,-1",
+	PokeNameHeartbroken: "心碎,4,-1",
+	PokeNameSixSixSix:   "666,5,-1",
+	PokeNameFangDaZhao:  "放大招,6,-1",
+}
+
+// ParseMiraiCode 解析MiraiCode字符串，返回对应的消息链
+//
+// 支持 [mirai:at:123]、[mirai:atall]、[mirai:face:id]、[mirai:image:imageId]、[mirai:flash:imageId]、
+// [mirai:dice:value]、[mirai:poke:name,type,id]、[mirai:app:content] 和 [mirai:service:id,content]，
+// 其它不认识的MiraiCode会原样保留为 MiraiCode 元素。普通文字中的 \ [ ] : , 以及换行需要用反斜杠转义。
+func ParseMiraiCode(code string) (MessageChain, error) {
+	var ret MessageChain
+	var text strings.Builder
+	flushText := func() {
+		if text.Len() > 0 {
+			ret = append(ret, &Plain{Type: "Plain", Text: text.String()})
+			text.Reset()
+		}
+	}
+	for i := 0; i < len(code); {
+		switch {
+		case code[i] == '\\':
+			if i+1 >= len(code) {
+				return nil, errors.New("unexpected end of mirai code after '\\'")
+			}
+			text.WriteString(unescapeMiraiCodeChar(code[i+1]))
+			i += 2
+		case strings.HasPrefix(code[i:], miraiCodePrefix):
+			end := findMiraiCodeEnd(code, i+len(miraiCodePrefix))
+			if end < 0 {
+				return nil, fmt.Errorf("unclosed mirai code at position %d", i)
+			}
+			m, err := parseMiraiCodeElement(code[i:end+1], code[i+len(miraiCodePrefix):end])
+			if err != nil {
+				return nil, err
+			}
+			flushText()
+			ret = append(ret, m)
+			i = end + 1
+		default:
+			text.WriteByte(code[i])
+			i++
+		}
+	}
+	flushText()
+	return ret, nil
+}
+
+// findMiraiCodeEnd 找到与 [mirai: 配对的未转义的 ]，找不到返回-1
+func findMiraiCodeEnd(code string, start int) int {
+	for i := start; i < len(code); i++ {
+		switch code[i] {
+		case '\\':
+			i++
+		case ']':
+			return i
+		}
+	}
+	return -1
+}
+
+func unescapeMiraiCodeChar(c byte) string {
+	switch c {
+	case 'n':
+		return "\n"
+	case 'r':
+		return "\r"
+	default:
+		return string(c)
+	}
+}
+
+func unescapeMiraiCode(s string) string {
+	if !strings.Contains(s, "\\") {
+		return s
+	}
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			i++
+			sb.WriteString(unescapeMiraiCodeChar(s[i]))
+		} else {
+			sb.WriteByte(s[i])
+		}
+	}
+	return sb.String()
+}
+
+var miraiCodeEscaper = strings.NewReplacer(
+	"\\", "\\\\",
+	"\n", "\\n",
+	"\r", "\\r",
+	"[", "\\[",
+	"]", "\\]",
+	":", "\\:",
+	",", "\\,",
+)
+
+// EscapeMiraiCode 对普通文字进行MiraiCode转义
+func EscapeMiraiCode(s string) string {
+	return miraiCodeEscaper.Replace(s)
+}
+
+// splitMiraiCodeArgs 按未转义的分隔符切分，最多切成n段（n<0表示不限），不做反转义
+func splitMiraiCodeArgs(s string, sep byte, n int) []string {
+	var ret []string
+	start := 0
+	for i := 0; i < len(s) && (n < 0 || len(ret) < n-1); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case sep:
+			ret = append(ret, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(ret, s[start:])
+}
+
+// parseMiraiCodeElement raw为完整的MiraiCode，body为去掉 [mirai: 和 ] 后的内容
+func parseMiraiCodeElement(raw, body string) (SingleMessage, error) {
+	parts := splitMiraiCodeArgs(body, ':', 2)
+	name := parts[0]
+	var rawArg string
+	if len(parts) > 1 {
+		rawArg = parts[1]
+	}
+	arg := unescapeMiraiCode(rawArg)
+	switch name {
+	case "at":
+		target, err := strconv.ParseInt(arg, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid mirai code %s: %w", raw, err)
+		}
+		return &At{Type: "At", Target: target}, nil
+	case "atall":
+		return &AtAll{Type: "AtAll"}, nil
+	case "face":
+		if id, err := strconv.ParseInt(arg, 10, 32); err == nil {
+			return &Face{Type: "Face", FaceId: int32(id)}, nil
+		}
+		if len(arg) == 0 {
+			return nil, fmt.Errorf("invalid mirai code %s: empty face", raw)
+		}
+		return &Face{Type: "Face", Name: arg}, nil
+	case "image":
+		if len(arg) == 0 {
+			return nil, fmt.Errorf("invalid mirai code %s: empty image", raw)
+		}
+		if strings.HasPrefix(arg, "http://") || strings.HasPrefix(arg, "https://") {
+			return &Image{Type: "Image", Url: arg}, nil
+		}
+		return &Image{Type: "Image", ImageId: arg}, nil
+	case "flash":
+		if len(arg) == 0 {
+			return nil, fmt.Errorf("invalid mirai code %s: empty image", raw)
+		}
+		if strings.HasPrefix(arg, "http://") || strings.HasPrefix(arg, "https://") {
+			return &FlashImage{Type: "FlashImage", Url: arg}, nil
+		}
+		return &FlashImage{Type: "FlashImage", ImageId: arg}, nil
+	case "dice":
+		value, err := strconv.ParseInt(arg, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid mirai code %s: %w", raw, err)
+		}
+		return &Dice{Type: "Dice", Value: int32(value)}, nil
+	case "poke":
+		args := splitMiraiCodeArgs(rawArg, ',', -1)
+		for i := range args {
+			args[i] = unescapeMiraiCode(args[i])
+		}
+		for pokeName, code := range pokeMiraiCode {
+			if args[0] == string(pokeName) || args[0] == strings.SplitN(code, ",", 2)[0] {
+				return &Poke{Type: "Poke", Name: pokeName}, nil
+			}
+		}
+		if len(args) >= 2 {
+			for pokeName, code := range pokeMiraiCode {
+				if strings.Split(code, ",")[1] == args[1] {
+					return &Poke{Type: "Poke", Name: pokeName}, nil
+				}
+			}
+		}
+		return nil, fmt.Errorf("invalid mirai code %s: unknown poke", raw)
+	case "app":
+		return &App{Type: "App", Content: arg}, nil
+	case "service":
+		args := splitMiraiCodeArgs(rawArg, ',', 2)
+		if len(args) != 2 {
+			return nil, fmt.Errorf("invalid mirai code %s: missing service content", raw)
+		}
+		if args[0] == "60" {
+			return &Xml{Type: "Xml", Xml: unescapeMiraiCode(args[1])}, nil
+		}
+		return &Json{Type: "Json", Json: unescapeMiraiCode(args[1])}, nil
+	default:
+		return &MiraiCode{Type: "MiraiCode", Code: raw}, nil
+	}
+}
+
+// MiraiCode 将消息链转为MiraiCode字符串。
+//
+// Source 和 Quote 会被忽略，无法用MiraiCode表示的消息（如 Voice、ForwardMessage 等）会转为其文字描述。
+func (c MessageChain) MiraiCode() string {
+	var sb strings.Builder
+	for _, m := range c {
+		switch m := m.(type) {
+		case *Source, *Quote:
+		case *Plain:
+			sb.WriteString(EscapeMiraiCode(m.Text))
+		case *At:
+			sb.WriteString(miraiCodePrefix + "at:" + strconv.FormatInt(m.Target, 10) + "]")
+		case *AtAll:
+			sb.WriteString(miraiCodePrefix + "atall]")
+		case *Face:
+			if m.FaceId != 0 || m.Name == "" {
+				sb.WriteString(miraiCodePrefix + "face:" + strconv.Itoa(int(m.FaceId)) + "]")
+			} else {
+				sb.WriteString(miraiCodePrefix + "face:" + EscapeMiraiCode(m.Name) + "]")
+			}
+		case *Image:
+			if m.ImageId != "" {
+				sb.WriteString(miraiCodePrefix + "image:" + EscapeMiraiCode(m.ImageId) + "]")
+			} else if m.Url != "" {
+				sb.WriteString(miraiCodePrefix + "image:" + EscapeMiraiCode(m.Url) + "]")
+			} else {
+				sb.WriteString(EscapeMiraiCode(m.String()))
+			}
+		case *FlashImage:
+			if m.ImageId != "" {
+				sb.WriteString(miraiCodePrefix + "flash:" + EscapeMiraiCode(m.ImageId) + "]")
+			} else if m.Url != "" {
+				sb.WriteString(miraiCodePrefix + "flash:" + EscapeMiraiCode(m.Url) + "]")
+			} else {
+				sb.WriteString(EscapeMiraiCode(m.String()))
+			}
+		case *Dice:
+			sb.WriteString(miraiCodePrefix + "dice:" + strconv.Itoa(int(m.Value)) + "]")
+		case *Poke:
+			if code, ok := pokeMiraiCode[m.Name]; ok {
+				sb.WriteString(miraiCodePrefix + "poke:" + code + "]")
+			} else {
+				sb.WriteString(EscapeMiraiCode(m.String()))
+			}
+		case *App:
+			sb.WriteString(miraiCodePrefix + "app:" + EscapeMiraiCode(m.Content) + "]")
+		case *Xml:
+			sb.WriteString(miraiCodePrefix + "service:60," + EscapeMiraiCode(m.Xml) + "]")
+		case *Json:
+			sb.WriteString(miraiCodePrefix + "service:1," + EscapeMiraiCode(m.Json) + "]")
+		case *MiraiCode:
+			sb.WriteString(m.Code)
+		case fmt.Stringer:
+			sb.WriteString(EscapeMiraiCode(m.String()))
+		}
+	}
+	return sb.String()
+}
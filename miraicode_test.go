@@ -0,0 +1,39 @@
+package miraihttp
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestParseMiraiCode(t *testing.T) {
+	chain, err := ParseMiraiCode(`hello\, world\n[mirai:at:123][mirai:atall][mirai:face:14][mirai:image:{01E9451B-70ED-EAE3-B37C-101F1EEBF5B5}.jpg][mirai:dice:3][mirai:poke:戳一戳,1,-1][mirai:unknown:1]`)
+	assert.Nil(t, err)
+	assert.Equal(t, MessageChain{
+		&Plain{Type: "Plain", Text: "hello, world\n"},
+		&At{Type: "At", Target: 123},
+		&AtAll{Type: "AtAll"},
+		&Face{Type: "Face", FaceId: 14},
+		&Image{Type: "Image", ImageId: "{01E9451B-70ED-EAE3-B37C-101F1EEBF5B5}.jpg"},
+		&Dice{Type: "Dice", Value: 3},
+		&Poke{Type: "Poke", Name: PokeNamePoke},
+		&MiraiCode{Type: "MiraiCode", Code: "[mirai:unknown:1]"},
+	}, chain)
+
+	_, err = ParseMiraiCode("[mirai:at:abc]")
+	assert.NotNil(t, err)
+	_, err = ParseMiraiCode("[mirai:at:123")
+	assert.NotNil(t, err)
+}
+
+func TestMiraiCodeRoundTrip(t *testing.T) {
+	chain := MessageChain{
+		&Source{Type: "Source", Id: 1},
+		&Plain{Type: "Plain", Text: "a[b]:c,d\\e\n"},
+		&At{Type: "At", Target: 123},
+		&Face{Type: "Face", Name: "微笑"},
+		&Poke{Type: "Poke", Name: PokeNameSixSixSix},
+	}
+	parsed, err := ParseMiraiCode(chain.MiraiCode())
+	assert.Nil(t, err)
+	assert.Equal(t, chain[1:], parsed)
+}
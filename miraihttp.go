@@ -5,12 +5,12 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"github.com/CuteReimu/goutil"
 	"github.com/gorilla/websocket"
 	"github.com/tidwall/gjson"
 	"golang.org/x/time/rate"
 	"log/slog"
-	"runtime/debug"
+	"reflect"
+	"runtime"
 	"strconv"
 	"sync"
 	"sync/atomic"
@@ -35,6 +35,7 @@ const (
 //
 // concurrentEvent 参数如果是true，表示采用并发方式处理事件和消息，由调用者自行解决并发问题。
 // 如果是false表示用单线程处理事件和消息，调用者无需关心并发问题。
+// 如果需要同一个群内按顺序处理、不同群之间并发处理，可以在连接后调用 Bot.SetKeyedDispatch 。
 func Connect(host string, port int, channel WsChannel, verifyKey string, qq int64, concurrentEvent bool) (*Bot, error) {
 	addr := fmt.Sprintf("ws://%s:%d/%s?verifyKey=%s&qq=%d", host, port, channel, verifyKey, qq)
 	log := slog.With("addr", addr)
@@ -45,83 +46,165 @@ func Connect(host string, port int, channel WsChannel, verifyKey string, qq int6
 		return nil, err
 	}
 	log.Info("Connected successfully")
-	b := &Bot{QQ: qq, c: c, handler: make(map[string][]listenHandler)}
+	b := newBot(qq)
+	b.c = c
 	if !concurrentEvent {
-		b.eventChan = goutil.NewBlockingQueue[func()]()
-		go func() {
-			for {
-				b.eventChan.Take()()
-			}
-		}()
+		b.eventChan = newEventQueue(b)
+		b.eventChan.startWorker()
 	}
 	go func() {
 		for {
 			t, message, err := c.ReadMessage()
-			if t != websocket.TextMessage {
-				continue
-			}
 			if err != nil {
 				log.Error("read error", "error", err)
+				b.getMetrics().Disconnected()
 				return
 			}
-			if !gjson.ValidBytes(message) {
-				log.Error("invalid json message: " + string(message))
-				continue
-			}
-			syncId := gjson.GetBytes(message, "syncId").String()
-			data := gjson.GetBytes(message, "data")
-			if data.Type != gjson.JSON {
-				log.Error("invalid json message: " + string(message))
-				continue
-			}
-			if len(syncId) > 0 && syncId[0] != '-' {
-				log.Debug("recv", "data", data, "syncId", syncId)
-				if ch, ok := b.syncIdMap.LoadAndDelete(syncId); ok {
-					ch0 := ch.(chan gjson.Result)
-					ch0 <- data
-					close(ch0)
-				}
+			if t != websocket.TextMessage {
 				continue
 			}
-			messageType := data.Get("type").String()
-			b.handlerLock.RLock()
-			if h, ok := b.handler[messageType]; ok {
-				b.handlerLock.RUnlock()
-				if p := decoder[messageType]; p == nil {
-					log.Error("cannot find message decoder: " + messageType)
-				} else if m := p(data); m != nil {
-					log.Debug("recv", "content", m)
-					fun := func() {
-						defer func() {
-							if r := recover(); r != nil {
-								log.Error("panic recovered", "error", r, "stack", string(debug.Stack()))
-							}
-						}()
-						for _, f := range h {
-							if !f(m) {
-								break
-							}
-						}
-					}
-					b.Run(fun)
-				}
-			} else {
-				b.handlerLock.RUnlock()
-			}
+			b.record(RecordInbound, message)
+			b.handleFrame(log, message)
 		}
 	}()
 	return b, nil
 }
 
+// handleFrame 处理收到的一条ws消息，在读取消息的协程中调用
+func (b *Bot) handleFrame(log *slog.Logger, message []byte) {
+	if !gjson.ValidBytes(message) {
+		log.Error("invalid json message: " + string(message))
+		return
+	}
+	syncId := gjson.GetBytes(message, "syncId").String()
+	data := gjson.GetBytes(message, "data")
+	if data.Type != gjson.JSON {
+		log.Error("invalid json message: " + string(message))
+		return
+	}
+	if len(syncId) > 0 && syncId[0] != '-' {
+		log.Debug("recv", "data", data, "syncId", syncId)
+		if ch, ok := b.syncIdMap.LoadAndDelete(syncId); ok {
+			b.pending.Add(-1)
+			ch0 := ch.(chan gjson.Result)
+			ch0 <- data
+			close(ch0)
+		}
+		return
+	}
+	messageType := data.Get("type").String()
+	if messageType == "" {
+		// 连接时的认证结果
+		if code := data.Get("code").Int(); code != 0 {
+			log.Error("auth failed", "code", code, "msg", data.Get("msg").String())
+		}
+		return
+	}
+	metrics := b.getMetrics()
+	metrics.EventReceived(messageType)
+	b.handlerLock.RLock()
+	h, ok := b.handler[messageType]
+	b.handlerLock.RUnlock()
+	cache := b.cache.Load()
+	store := b.getMessageStore()
+	archiver := b.archiver.Load()
+	if !ok && cache == nil && store == nil && archiver == nil && !b.hasWaiter() {
+		metrics.EventDropped(messageType, DropReasonNoHandler)
+		return
+	}
+	p := decoder[messageType]
+	if p == nil {
+		log.Error("cannot find message decoder: " + messageType)
+		metrics.EventDropped(messageType, DropReasonUnknownType)
+		return
+	}
+	m := p(data)
+	if m == nil {
+		metrics.EventDropped(messageType, DropReasonDecodeFailed)
+		return
+	}
+	metrics.EventDecoded(messageType)
+	log.Debug("recv", "content", m)
+	if cache != nil {
+		cache.handleEvent(m)
+	}
+	if store != nil {
+		b.storeReceived(store, m)
+	}
+	if archiver != nil {
+		archiver.record(m, nil)
+	}
+	if b.deliverToWaiter(m) || !ok {
+		return
+	}
+	fun := func(ctx context.Context) {
+		ctx, span := b.startSpan(ctx, "event "+messageType, func() []Attribute {
+			return eventAttributes(messageType, data)
+		})
+		defer span.End()
+		for _, f := range h {
+			if !b.runHandler(ctx, f, m) {
+				break
+			}
+		}
+	}
+	b.dispatch(messageType, data, m, fun)
+}
+
+// Bot 与mirai-api-http的一个连接。用 WithContext 得到的 Bot 与原来的共享同一个连接和所有的状态
 type Bot struct {
-	QQ          int64
+	QQ int64
+	*botState
+	ctx context.Context // 由 WithContext 设置，请求的span以它为父span
+}
+
+func newBot(qq int64) *Bot {
+	return &Bot{QQ: qq, botState: &botState{handler: make(map[string][]*listenHandler)}}
+}
+
+// WithContext 返回一个使用ctx的 Bot ，通过它发送的请求会以ctx中的span为父span，见 Tracer
+func (b *Bot) WithContext(ctx context.Context) *Bot {
+	return &Bot{QQ: b.QQ, botState: b.botState, ctx: ctx}
+}
+
+// Context 获取 WithContext 设置的ctx，没有设置过时返回 context.Background()
+func (b *Bot) Context() context.Context {
+	if b.ctx != nil {
+		return b.ctx
+	}
+	return context.Background()
+}
+
+// botState 同一个连接的 Bot 共享的状态
+type botState struct {
 	c           *websocket.Conn
+	writeLock   sync.Mutex // websocket.Conn 不支持并发写
 	syncId      atomic.Int64
 	handlerLock sync.RWMutex
-	handler     map[string][]listenHandler
+	handler     map[string][]*listenHandler
 	syncIdMap   sync.Map
-	eventChan   *goutil.BlockingQueue[func()]
+	eventChan   *eventQueue
+	keyed       atomic.Pointer[keyedDispatcher]
 	limiter     atomic.Pointer[limiter]
+	waiterLock  sync.Mutex
+	waiters     []*waiter
+
+	dispatchOption atomic.Pointer[DispatchOption]
+	pool           atomic.Pointer[eventQueue]
+	stats          eventStats
+	panicHandler   atomic.Pointer[PanicHandler]
+	panicNotifyQQ  atomic.Int64
+	cache          atomic.Pointer[ContactCache]
+	messageStore   atomic.Pointer[MessageStore]
+	archiver       atomic.Pointer[Archiver]
+	imageCache     atomic.Pointer[ImageCache]
+	sentHookLock   sync.RWMutex
+	sentHooks      []func(message *SentMessage)
+	recorder       atomic.Pointer[trafficRecorder]
+	clock          atomic.Pointer[Clock]
+	metrics        atomic.Pointer[Metrics]
+	tracer         atomic.Pointer[Tracer]
+	pending        atomic.Int64 // syncIdMap 中的请求数
 }
 
 type limiter struct {
@@ -147,20 +230,46 @@ func (b *Bot) SetLimiter(limiterType string, l *rate.Limiter) {
 }
 
 // Run 如果不是并发方式启动，则此方法会将函数放入事件队列。如果是并发方式启动，则此方法等同于go f()。
+// 如果设置了 SetKeyedDispatch ，则此方法会将函数放入键为空串的队列。
+// 如果并发方式启动并且 DispatchOption 中设置了 Workers ，则此方法会将函数放入协程池的队列。
 func (b *Bot) Run(f func()) {
-	if b.eventChan == nil {
-		go f()
-	} else {
+	b.run(func(context.Context) { f() })
+}
+
+// run 与 Run 相同，在队列中执行时f收到的ctx中有处理它的 workerRun
+func (b *Bot) run(f func(ctx context.Context)) {
+	if d := b.keyed.Load(); d != nil {
+		d.put("", f)
+	} else if b.eventChan != nil {
 		b.eventChan.Put(f)
+	} else if pool := b.pool.Load(); pool != nil {
+		pool.Put(f)
+	} else {
+		b.stats.running.Add(1)
+		go func() {
+			defer b.stats.running.Add(-1)
+			defer b.stats.processed.Add(1)
+			f(context.Background())
+		}()
 	}
 }
 
 // request 发送请求
 func (b *Bot) request(command, subCommand string, m any) (gjson.Result, error) {
+	metrics := b.getMetrics()
 	limiter := b.limiter.Load()
 	if limiter != nil && !limiter.check() {
+		metrics.LimiterRejected(command, subCommand)
 		return gjson.Result{}, errors.New("rate limit exceeded")
 	}
+	start := time.Now()
+	result, err := b.send(command, subCommand, m)
+	metrics.RequestDone(command, subCommand, time.Since(start), err)
+	return result, err
+}
+
+// send 发送请求并等待返回，如果设置了 Tracer 则以 b.Context() 中的span为父span创建一个span
+func (b *Bot) send(command, subCommand string, m any) (result gjson.Result, err error) {
 	msg := &requestMessage{
 		SyncId:     b.syncId.Add(1),
 		Command:    command,
@@ -174,19 +283,38 @@ func (b *Bot) request(command, subCommand string, m any) (gjson.Result, error) {
 		log.Error("json marshal failed", "error", err)
 		return gjson.Result{}, err
 	}
+	b.record(RecordOutbound, buf)
+	_, span := b.startSpan(b.Context(), "request "+command, func() []Attribute {
+		return requestAttributes(command, subCommand, syncId, buf)
+	})
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+		}
+		span.End()
+	}()
 	ch := make(chan gjson.Result, 1)
 	b.syncIdMap.Store(syncId, ch)
+	b.pending.Add(1)
+	// 在发送之前开始计时，这样返回不可能早于定时器到达
+	timeoutTimer := b.Clock().AfterFunc(5*time.Second, func() {
+		if ch, ok := b.syncIdMap.LoadAndDelete(syncId); ok {
+			b.pending.Add(-1)
+			close(ch.(chan gjson.Result))
+		}
+	})
+	b.writeLock.Lock()
 	err = b.c.WriteMessage(websocket.TextMessage, buf)
+	b.writeLock.Unlock()
 	if err != nil {
+		timeoutTimer.Stop()
+		if _, ok := b.syncIdMap.LoadAndDelete(syncId); ok {
+			b.pending.Add(-1)
+		}
 		log.Error("send error", "error", err)
 		return gjson.Result{}, err
 	}
 	log.Debug("send", "content", m, "syncId", syncId, "cmd", command, "subCmd", subCommand)
-	timeoutTimer := time.AfterFunc(5*time.Second, func() {
-		if ch, ok := b.syncIdMap.LoadAndDelete(syncId); ok {
-			close(ch.(chan gjson.Result))
-		}
-	})
 	result, ok := <-ch
 	if !ok {
 		log.Error("request timeout")
@@ -223,10 +351,38 @@ type requestMessage struct {
 
 var decoder = make(map[string]func(data gjson.Result) any)
 
-type listenHandler func(message any) bool
+type listenHandler struct {
+	f    func(ctx context.Context, message any) bool // ctx是这次调用的监听函数的span所在的ctx
+	info HandlerInfo
+}
 
 func listen[M any](b *Bot, key string, l func(message M) bool) {
+	addHandler(b, key, 3, func(_ context.Context, m any) bool { return l(m.(M)) })
+}
+
+// ListenContext 监听M类型的消息或事件，M是消息或事件的指针类型，例如 *GroupMessage 。
+// 与对应的Listen方法相同，但是监听函数额外接收一个ctx，设置了 Tracer 时其中包含这次调用的监听函数的span，
+// 用 Bot.WithContext 发送的请求会成为它的子span
+func ListenContext[M any](b *Bot, l func(ctx context.Context, message M) bool) {
+	key := reflect.TypeOf((*M)(nil)).Elem()
+	if key.Kind() == reflect.Pointer {
+		key = key.Elem()
+	}
+	if _, ok := decoder[key.Name()]; !ok {
+		slog.Error("unknown message type", "type", key.String())
+		return
+	}
+	addHandler(b, key.Name(), 2, func(ctx context.Context, m any) bool { return l(ctx, m.(M)) })
+}
+
+// addHandler 添加一个监听函数，skip是从注册监听的位置到这里的调用层数
+func addHandler(b *Bot, key string, skip int, f func(ctx context.Context, message any) bool) {
+	info := HandlerInfo{EventType: key}
+	if _, file, line, ok := runtime.Caller(skip); ok {
+		info.Site = file + ":" + strconv.Itoa(line)
+	}
 	b.handlerLock.Lock()
 	defer b.handlerLock.Unlock()
-	b.handler[key] = append(b.handler[key], func(m any) bool { return l(m.(M)) })
+	info.Index = len(b.handler[key])
+	b.handler[key] = append(b.handler[key], &listenHandler{f: f, info: info})
 }
@@ -0,0 +1,82 @@
+// Package miraiotel 把OpenTelemetry适配为 miraihttp.Tracer ，例如：
+//
+//	b.SetTracer(miraiotel.NewTracer(otel.Tracer("my-bot")))
+//
+// 它是一个单独的module，只有使用它时才需要依赖OpenTelemetry
+package miraiotel
+
+import (
+	"context"
+	"fmt"
+	miraihttp "github.com/CuteReimu/mirai-sdk-http"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type tracer struct {
+	t trace.Tracer
+}
+
+// NewTracer 用OpenTelemetry的 trace.Tracer 创建一个 miraihttp.Tracer 。
+// 事件的span是 trace.SpanKindConsumer ，请求的span是 trace.SpanKindClient ，其它的是 trace.SpanKindInternal
+func NewTracer(t trace.Tracer) miraihttp.Tracer {
+	return &tracer{t: t}
+}
+
+func (t *tracer) Start(ctx context.Context, name string, attrs ...miraihttp.Attribute) (context.Context, miraihttp.Span) {
+	ctx, s := t.t.Start(ctx, name, trace.WithSpanKind(spanKind(attrs)), trace.WithAttributes(convert(attrs)...))
+	return ctx, &span{s: s}
+}
+
+// spanKind 根据属性判断是请求、监听函数还是事件的span
+func spanKind(attrs []miraihttp.Attribute) trace.SpanKind {
+	kind := trace.SpanKindInternal
+	for _, a := range attrs {
+		switch a.Key {
+		case miraihttp.AttrCommand:
+			return trace.SpanKindClient
+		case miraihttp.AttrHandlerSite:
+			return trace.SpanKindInternal
+		case miraihttp.AttrEventType:
+			kind = trace.SpanKindConsumer
+		}
+	}
+	return kind
+}
+
+type span struct {
+	s trace.Span
+}
+
+func (s *span) SetAttributes(attrs ...miraihttp.Attribute) {
+	s.s.SetAttributes(convert(attrs)...)
+}
+
+func (s *span) RecordError(err error) {
+	s.s.RecordError(err)
+	s.s.SetStatus(codes.Error, err.Error())
+}
+
+func (s *span) End() {
+	s.s.End()
+}
+
+func convert(attrs []miraihttp.Attribute) []attribute.KeyValue {
+	ret := make([]attribute.KeyValue, 0, len(attrs))
+	for _, a := range attrs {
+		switch v := a.Value.(type) {
+		case string:
+			ret = append(ret, attribute.String(a.Key, v))
+		case int64:
+			ret = append(ret, attribute.Int64(a.Key, v))
+		case int:
+			ret = append(ret, attribute.Int(a.Key, v))
+		case bool:
+			ret = append(ret, attribute.Bool(a.Key, v))
+		default:
+			ret = append(ret, attribute.String(a.Key, fmt.Sprint(v)))
+		}
+	}
+	return ret
+}
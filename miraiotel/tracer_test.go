@@ -0,0 +1,82 @@
+package miraiotel
+
+import (
+	"context"
+	miraihttp "github.com/CuteReimu/mirai-sdk-http"
+	"github.com/CuteReimu/mirai-sdk-http/miraitest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"testing"
+)
+
+func findSpan(t *testing.T, spans []sdktrace.ReadOnlySpan, name string) sdktrace.ReadOnlySpan {
+	t.Helper()
+	for _, s := range spans {
+		if s.Name() == name {
+			return s
+		}
+	}
+	t.Fatalf("cannot find span %s", name)
+	return nil
+}
+
+func attr(s sdktrace.ReadOnlySpan, key string) attribute.Value {
+	for _, kv := range s.Attributes() {
+		if string(kv.Key) == key {
+			return kv.Value
+		}
+	}
+	return attribute.Value{}
+}
+
+func TestTracer(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	h := miraitest.NewHarness(t)
+	b := h.Bot
+	b.SetTracer(NewTracer(provider.Tracer("test")))
+	miraihttp.ListenContext(b, func(ctx context.Context, message *miraihttp.GroupMessage) bool {
+		b := b.WithContext(ctx)
+		_, _ = message.Reply(b, miraihttp.MessageChain{&miraihttp.Plain{Text: "禁言"}})
+		_ = b.Mute(message.Sender.Group.Id, message.Sender.Id, 60)
+		return true
+	})
+	b.ListenGroupMessage(func(*miraihttp.GroupMessage) bool {
+		panic("test")
+	})
+	h.GroupSay(100, 1, "hello")
+	h.ExpectGroupReply(100, "禁言")
+
+	spans := recorder.Ended()
+	event := findSpan(t, spans, "event GroupMessage")
+	assert.Equal(t, trace.SpanKindConsumer, event.SpanKind())
+	assert.Equal(t, int64(100), attr(event, miraihttp.AttrGroup).AsInt64())
+
+	var handlers []sdktrace.ReadOnlySpan
+	for _, s := range spans {
+		if s.Name() == "handler" {
+			handlers = append(handlers, s)
+		}
+	}
+	require.Len(t, handlers, 2)
+	for _, s := range handlers {
+		assert.Equal(t, event.SpanContext().SpanID(), s.Parent().SpanID())
+	}
+	assert.Equal(t, int64(1), attr(handlers[1], miraihttp.AttrHandlerIndex).AsInt64())
+	assert.Equal(t, codes.Error, handlers[1].Status().Code)
+
+	for _, name := range []string{"request sendGroupMessage", "request mute"} {
+		s := findSpan(t, spans, name)
+		assert.Equal(t, trace.SpanKindClient, s.SpanKind())
+		assert.Equal(t, handlers[0].SpanContext().SpanID(), s.Parent().SpanID())
+		assert.Equal(t, event.SpanContext().TraceID(), s.SpanContext().TraceID())
+		assert.Equal(t, int64(100), attr(s, miraihttp.AttrGroup).AsInt64())
+		assert.NotEmpty(t, attr(s, miraihttp.AttrSyncId).AsString())
+	}
+	assert.Equal(t, "mute", attr(findSpan(t, spans, "request mute"), miraihttp.AttrCommand).AsString())
+}
@@ -0,0 +1,77 @@
+package miraitest
+
+import (
+	miraihttp "github.com/CuteReimu/mirai-sdk-http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// FakeClock 手动推进的时钟，实现了 miraihttp.Clock
+type FakeClock struct {
+	lock   sync.Mutex
+	now    time.Time
+	timers []*fakeTimer
+}
+
+type fakeTimer struct {
+	c    *FakeClock
+	when time.Time
+	f    func()
+}
+
+// NewFakeClock 新建一个时钟，当前时间为now
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{now: now}
+}
+
+func (c *FakeClock) Now() time.Time {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.now
+}
+
+// AfterFunc 在时钟被推进d之后调用f，d<=0时立即在新协程中调用f
+func (c *FakeClock) AfterFunc(d time.Duration, f func()) miraihttp.Timer {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	t := &fakeTimer{c: c, when: c.now.Add(d), f: f}
+	if d <= 0 {
+		go f()
+		return t
+	}
+	c.timers = append(c.timers, t)
+	return t
+}
+
+func (t *fakeTimer) Stop() bool {
+	t.c.lock.Lock()
+	defer t.c.lock.Unlock()
+	for i, timer := range t.c.timers {
+		if timer == t {
+			t.c.timers = append(t.c.timers[:i], t.c.timers[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Advance 把时钟推进d，并按时间顺序在当前协程中调用所有到期的定时器
+func (c *FakeClock) Advance(d time.Duration) {
+	c.lock.Lock()
+	c.now = c.now.Add(d)
+	var due, rest []*fakeTimer
+	for _, t := range c.timers {
+		if t.when.After(c.now) {
+			rest = append(rest, t)
+		} else {
+			due = append(due, t)
+		}
+	}
+	c.timers = rest
+	c.lock.Unlock()
+	sort.SliceStable(due, func(i, j int) bool { return due[i].when.Before(due[j].when) })
+	for _, t := range due {
+		t.f()
+	}
+}
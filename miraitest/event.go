@@ -0,0 +1,76 @@
+package miraitest
+
+import (
+	"encoding/json"
+	miraihttp "github.com/CuteReimu/mirai-sdk-http"
+	"sync/atomic"
+	"time"
+)
+
+// Event 推送给Bot的一条消息或事件，即ws消息中的data字段
+type Event map[string]any
+
+var messageId atomic.Int64
+
+// NewEvent 把带有json标签的事件结构体转换为 Event ，例如 NewEvent("NudgeEvent", &miraihttp.NudgeEvent{...})。
+// 无法转换为json对象时会panic
+func NewEvent(eventType string, v any) Event {
+	buf, err := json.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+	e := Event{}
+	if err = json.Unmarshal(buf, &e); err != nil {
+		panic(err)
+	}
+	e["type"] = eventType
+	return e
+}
+
+// Chain 构造收到的消息链，会填上每个元素的Type字段。如果第一个元素不是 miraihttp.Source ，会自动加上一个，消息id自增，时间是当前时间
+func Chain(messages ...miraihttp.SingleMessage) miraihttp.MessageChain {
+	return ChainAt(time.Now(), messages...)
+}
+
+// ChainAt 与 Chain 相同，但是自动加上的 miraihttp.Source 的时间是now。 Harness 用它的 Clock 的时间构造消息
+func ChainAt(now time.Time, messages ...miraihttp.SingleMessage) miraihttp.MessageChain {
+	chain := make(miraihttp.MessageChain, 0, len(messages)+1)
+	if len(messages) == 0 {
+		chain = append(chain, newSource(now))
+	} else if _, ok := messages[0].(*miraihttp.Source); !ok {
+		chain = append(chain, newSource(now))
+	}
+	chain = append(chain, messages...)
+	for _, m := range chain {
+		m.FillMessageType()
+	}
+	return chain
+}
+
+func newSource(now time.Time) *miraihttp.Source {
+	return &miraihttp.Source{Id: messageId.Add(1), Time: now.Unix()}
+}
+
+func messageEvent(messageType string, sender any, chain miraihttp.MessageChain) Event {
+	return Event{"type": messageType, "sender": sender, "messageChain": chain}
+}
+
+// FriendMessage 构造一条好友消息
+func FriendMessage(sender miraihttp.Friend, messages ...miraihttp.SingleMessage) Event {
+	return messageEvent("FriendMessage", sender, Chain(messages...))
+}
+
+// GroupMessage 构造一条群消息
+func GroupMessage(sender miraihttp.Member, messages ...miraihttp.SingleMessage) Event {
+	return messageEvent("GroupMessage", sender, Chain(messages...))
+}
+
+// TempMessage 构造一条群临时消息
+func TempMessage(sender miraihttp.Member, messages ...miraihttp.SingleMessage) Event {
+	return messageEvent("TempMessage", sender, Chain(messages...))
+}
+
+// StrangerMessage 构造一条陌生人消息
+func StrangerMessage(sender miraihttp.Friend, messages ...miraihttp.SingleMessage) Event {
+	return messageEvent("StrangerMessage", sender, Chain(messages...))
+}
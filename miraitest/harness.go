@@ -0,0 +1,247 @@
+package miraitest
+
+import (
+	"encoding/json"
+	"fmt"
+	miraihttp "github.com/CuteReimu/mirai-sdk-http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// BotQQ Harness 中Bot的QQ号
+const BotQQ int64 = 10000
+
+// Reply Bot发出的一条消息
+type Reply struct {
+	Command      string // sendGroupMessage, sendFriendMessage 或 sendTempMessage
+	Target       int64  // 群号或者好友QQ号，临时会话时为对方的QQ号
+	Group        int64  // 群号，好友消息时为0
+	Quote        int64  // 引用回复的消息id
+	MessageChain miraihttp.MessageChain
+}
+
+func (r *Reply) String() string {
+	return fmt.Sprintf("%s(%d): %s", r.Command, r.Target, r.MessageChain.String())
+}
+
+// Harness 测试监听函数用的工具，模拟群成员和好友发消息，并检查Bot的回复。
+//
+// Bot以单线程方式连接，每次模拟发消息后都会等到Bot处理完（或者用监听函数收到的ctx在 miraihttp.Bot.WaitNext 中等待）才返回，
+// 因此测试的结果是确定的。
+// Bot的时钟是 Clock ，可以用 Advance 推进，用于测试超时。
+type Harness struct {
+	T      testing.TB
+	Server *Server
+	Bot    *miraihttp.Bot
+	Clock  *FakeClock
+
+	members  map[[2]int64]miraihttp.Member
+	friends  map[int64]miraihttp.Friend
+	consumed int // 已经检查过的请求数
+	replies  []*Reply
+}
+
+// NewHarness 启动一个 Server 并连接一个Bot，测试结束时自动关闭
+func NewHarness(t testing.TB) *Harness {
+	t.Helper()
+	s := NewServer("miraitest", BotQQ)
+	t.Cleanup(s.Close)
+	b, err := s.Connect(false)
+	if err != nil {
+		t.Fatalf("connect failed: %v", err)
+	}
+	clock := NewFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.Local))
+	b.SetClock(clock)
+	return &Harness{
+		T:       t,
+		Server:  s,
+		Bot:     b,
+		Clock:   clock,
+		members: make(map[[2]int64]miraihttp.Member),
+		friends: make(map[int64]miraihttp.Friend),
+	}
+}
+
+// SetMember 设置群成员的信息，之后这个成员发的消息会使用这些信息。没有设置过的成员是普通成员，群名片为空
+func (h *Harness) SetMember(m miraihttp.Member) {
+	h.members[[2]int64{m.Group.Id, m.Id}] = m
+}
+
+// SetFriend 设置好友的信息，之后这个好友发的消息会使用这些信息
+func (h *Harness) SetFriend(f miraihttp.Friend) {
+	h.friends[f.Id] = f
+}
+
+func (h *Harness) member(group, qq int64) miraihttp.Member {
+	if m, ok := h.members[[2]int64{group, qq}]; ok {
+		return m
+	}
+	return miraihttp.Member{Id: qq, Permission: miraihttp.PermMember, Group: miraihttp.Group{Id: group, Permission: miraihttp.PermMember}}
+}
+
+func (h *Harness) friend(qq int64) miraihttp.Friend {
+	if f, ok := h.friends[qq]; ok {
+		return f
+	}
+	return miraihttp.Friend{Id: qq}
+}
+
+// chain 构造消息链，消息的时间取自 Clock
+func (h *Harness) chain(messages ...miraihttp.SingleMessage) miraihttp.MessageChain {
+	return ChainAt(h.Clock.Now(), messages...)
+}
+
+// GroupSay 模拟群成员发送一条文字消息
+func (h *Harness) GroupSay(group, qq int64, text string) {
+	h.T.Helper()
+	h.GroupSayChain(group, qq, &miraihttp.Plain{Text: text})
+}
+
+// GroupSayChain 模拟群成员发送一条消息
+func (h *Harness) GroupSayChain(group, qq int64, messages ...miraihttp.SingleMessage) {
+	h.T.Helper()
+	h.Inject(messageEvent("GroupMessage", h.member(group, qq), h.chain(messages...)))
+}
+
+// FriendSay 模拟好友发送一条文字消息
+func (h *Harness) FriendSay(qq int64, text string) {
+	h.T.Helper()
+	h.FriendSayChain(qq, &miraihttp.Plain{Text: text})
+}
+
+// FriendSayChain 模拟好友发送一条消息
+func (h *Harness) FriendSayChain(qq int64, messages ...miraihttp.SingleMessage) {
+	h.T.Helper()
+	h.Inject(messageEvent("FriendMessage", h.friend(qq), h.chain(messages...)))
+}
+
+// TempSay 模拟群成员通过临时会话发送一条文字消息
+func (h *Harness) TempSay(group, qq int64, text string) {
+	h.T.Helper()
+	h.Inject(messageEvent("TempMessage", h.member(group, qq), h.chain(&miraihttp.Plain{Text: text})))
+}
+
+// Nudge 模拟戳一戳，group为0表示好友之间的戳一戳
+func (h *Harness) Nudge(group, from, target int64) {
+	h.T.Helper()
+	e := &miraihttp.NudgeEvent{FromId: from, Action: "戳了戳", Target: target}
+	if group != 0 {
+		e.Subject.Id, e.Subject.Kind = group, miraihttp.KindGroup
+	} else {
+		e.Subject.Id, e.Subject.Kind = from, miraihttp.KindFriend
+	}
+	h.Inject(NewEvent("NudgeEvent", e))
+}
+
+// Inject 推送一条消息或事件，并等待Bot处理完
+func (h *Harness) Inject(e Event) {
+	h.T.Helper()
+	if err := h.Server.Inject(e); err != nil {
+		h.T.Fatalf("inject event failed: %v", err)
+	}
+	h.Sync()
+}
+
+// Advance 推进时钟，并等待Bot处理完因此触发的超时
+func (h *Harness) Advance(d time.Duration) {
+	h.T.Helper()
+	h.Clock.Advance(d)
+	h.Sync()
+}
+
+// Sync 等待Bot处理完已经收到的所有事件。
+// 会先发送一个about请求，它的返回一定在之前推送的事件之后到达，再等待事件队列为空，并且除了在等待下一条消息的，所有事件都处理完
+func (h *Harness) Sync() {
+	h.T.Helper()
+	if _, err := h.Bot.About(); err != nil {
+		h.T.Fatalf("sync failed: %v", err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		s := h.Bot.EventStats()
+		if s.Queued == 0 && s.Running == s.Parked {
+			return
+		}
+		if time.Now().After(deadline) {
+			h.T.Fatalf("handlers are still running after 5 seconds: %+v", s)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// Replies 获取Bot发出的、还没有被 ExpectGroupReply 等方法检查过的消息
+func (h *Harness) Replies() []*Reply {
+	h.T.Helper()
+	commands := h.Server.Commands("")
+	if h.consumed > len(commands) {
+		// 调用过 Server.Reset
+		h.consumed = 0
+	}
+	for ; h.consumed < len(commands); h.consumed++ {
+		cmd := commands[h.consumed]
+		var content struct {
+			Target       int64                  `json:"target"`
+			QQ           int64                  `json:"qq"`
+			Group        int64                  `json:"group"`
+			Quote        int64                  `json:"quote"`
+			MessageChain miraihttp.MessageChain `json:"messageChain"`
+		}
+		switch cmd.Command {
+		case "sendGroupMessage", "sendFriendMessage", "sendTempMessage":
+		default:
+			continue
+		}
+		if err := json.Unmarshal(cmd.Content, &content); err != nil {
+			h.T.Fatalf("invalid %s content: %v", cmd.Command, err)
+		}
+		r := &Reply{Command: cmd.Command, Target: content.Target, Quote: content.Quote, MessageChain: content.MessageChain}
+		switch cmd.Command {
+		case "sendGroupMessage":
+			r.Group = content.Target
+		case "sendTempMessage":
+			r.Target, r.Group = content.QQ, content.Group
+		}
+		h.replies = append(h.replies, r)
+	}
+	return h.replies
+}
+
+func (h *Harness) expect(command string, target int64, contains string) *Reply {
+	h.T.Helper()
+	replies := h.Replies()
+	for i, r := range replies {
+		if r.Command == command && r.Target == target && strings.Contains(r.MessageChain.String(), contains) {
+			h.replies = append(replies[:i:i], replies[i+1:]...)
+			return r
+		}
+	}
+	h.T.Fatalf("expected %s(%d) containing %q, but got %v", command, target, contains, replies)
+	return nil
+}
+
+// ExpectGroupReply 检查Bot在群里发出了一条包含contains的消息，找到后这条消息不会再被检查
+func (h *Harness) ExpectGroupReply(group int64, contains string) *Reply {
+	h.T.Helper()
+	return h.expect("sendGroupMessage", group, contains)
+}
+
+// ExpectFriendReply 检查Bot给好友发出了一条包含contains的消息，找到后这条消息不会再被检查
+func (h *Harness) ExpectFriendReply(qq int64, contains string) *Reply {
+	h.T.Helper()
+	return h.expect("sendFriendMessage", qq, contains)
+}
+
+// ExpectTempReply 检查Bot通过临时会话发出了一条包含contains的消息，找到后这条消息不会再被检查
+func (h *Harness) ExpectTempReply(qq int64, contains string) *Reply {
+	h.T.Helper()
+	return h.expect("sendTempMessage", qq, contains)
+}
+
+// ExpectNoReply 检查Bot没有发出其它还没有被检查过的消息
+func (h *Harness) ExpectNoReply() {
+	h.T.Helper()
+	if replies := h.Replies(); len(replies) > 0 {
+		h.T.Fatalf("expected no reply, but got %v", replies)
+	}
+}
@@ -0,0 +1,127 @@
+package miraitest
+
+import (
+	"context"
+	miraihttp "github.com/CuteReimu/mirai-sdk-http"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func text(s string) miraihttp.MessageChain {
+	return miraihttp.MessageChain{&miraihttp.Plain{Text: s}}
+}
+
+func TestHarness(t *testing.T) {
+	h := NewHarness(t)
+	b := h.Bot
+	miraihttp.ListenContext(b, func(ctx context.Context, message *miraihttp.GroupMessage) bool {
+		if message.MessageChain.PlainText() != "猜数字" {
+			return true
+		}
+		_, _ = message.Reply(b, text("请输入一个数字"))
+		ctx, cancel := b.WithTimeout(ctx, time.Minute)
+		defer cancel()
+		next, err := message.WaitNextFromSender(ctx, b)
+		if err != nil {
+			_, _ = message.Reply(b, text("超时了"))
+			return true
+		}
+		_, _ = next.QuoteReply(b, text("你猜的是"+next.MessageChain.PlainText()))
+		return true
+	})
+	b.ListenNudgeEvent(func(e *miraihttp.NudgeEvent) bool {
+		if e.Target == b.QQ {
+			_, _ = b.SendGroupMessage(e.Subject.Id, 0, text("别戳了"))
+		}
+		return true
+	})
+
+	h.GroupSay(100, 1, "猜数字")
+	h.ExpectGroupReply(100, "请输入")
+	h.GroupSay(100, 2, "别人说的话")
+	h.ExpectNoReply()
+	h.GroupSay(100, 1, "42")
+	r := h.ExpectGroupReply(100, "你猜的是42")
+	assert.NotZero(t, r.Quote)
+
+	h.GroupSay(100, 1, "猜数字")
+	h.ExpectGroupReply(100, "请输入")
+	h.Advance(30 * time.Second)
+	h.ExpectNoReply()
+	h.Advance(30 * time.Second)
+	h.ExpectGroupReply(100, "超时了")
+
+	h.Nudge(100, 1, BotQQ)
+	h.ExpectGroupReply(100, "别戳了")
+	h.Nudge(100, 1, 2)
+	h.ExpectNoReply()
+}
+
+func TestHandlerTimeoutWithFakeClock(t *testing.T) {
+	h := NewHarness(t)
+	b := h.Bot
+	if err := b.SetDispatchOption(miraihttp.DispatchOption{HandlerTimeout: time.Second}); err != nil {
+		t.Fatal(err)
+	}
+	release := make(chan struct{})
+	defer close(release)
+	b.ListenFriendMessage(func(*miraihttp.FriendMessage) bool {
+		<-release
+		return true
+	})
+	b.ListenFriendMessage(func(message *miraihttp.FriendMessage) bool {
+		_, _ = b.SendFriendMessage(message.Sender.Id, 0, text("next"))
+		return true
+	})
+	assert.NoError(t, h.Server.Inject(FriendMessage(miraihttp.Friend{Id: 1}, &miraihttp.Plain{Text: "hi"})))
+	_, err := h.Server.WaitCommand("sendFriendMessage", 50*time.Millisecond)
+	assert.Error(t, err)
+	h.Advance(time.Second)
+	h.ExpectFriendReply(1, "next")
+	assert.Equal(t, int64(1), b.EventStats().TimedOut)
+}
+
+func TestRequestTimeoutWithFakeClock(t *testing.T) {
+	h := NewHarness(t)
+	release := make(chan struct{})
+	defer close(release)
+	h.Server.Handle("about", func(*Command) Response {
+		<-release
+		return OK(nil)
+	})
+	errCh := make(chan error, 1)
+	go func() {
+		_, err := h.Bot.About()
+		errCh <- err
+	}()
+	_, err := h.Server.WaitCommand("about", time.Second)
+	assert.NoError(t, err)
+	select {
+	case err = <-errCh:
+		t.Fatalf("request returned before the clock advanced: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	h.Clock.Advance(5 * time.Second)
+	select {
+	case err = <-errCh:
+		assert.EqualError(t, err, "request timeout")
+	case <-time.After(time.Second):
+		t.Fatal("request did not time out")
+	}
+}
+
+func TestHarnessMessageTime(t *testing.T) {
+	h := NewHarness(t)
+	times := make(chan int64, 2)
+	h.Bot.ListenFriendMessage(func(message *miraihttp.FriendMessage) bool {
+		times <- message.MessageChain.Source().Time
+		return true
+	})
+	h.FriendSay(1, "a")
+	h.Advance(time.Hour)
+	h.FriendSay(1, "b")
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.Local)
+	assert.Equal(t, start.Unix(), <-times)
+	assert.Equal(t, start.Add(time.Hour).Unix(), <-times)
+}
@@ -0,0 +1,88 @@
+package miraitest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	miraihttp "github.com/CuteReimu/mirai-sdk-http"
+	"time"
+)
+
+func replayKey(command, subCommand string) string {
+	return command + "/" + subCommand
+}
+
+// decodeObject 解析json对象，保留整数的精度
+func decodeObject(data []byte) (map[string]any, error) {
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+	var m map[string]any
+	if err := d.Decode(&m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Replay 重放用 miraihttp.Bot.SetTrafficRecorder 录制的内容。
+// 录制中收到的消息和事件按照录制时的间隔依次推送给Bot，间隔会除以speed，speed<=0表示不等待。
+// Bot发出的请求按照请求种类依次使用录制中同种请求的返回，用完之后按照 Handle 设置的或者默认的规则返回。
+// 推送完所有消息和事件后返回，不会等待Bot处理完
+func (s *Server) Replay(ctx context.Context, records []*miraihttp.TrafficRecord, speed float64) error {
+	responses := make(map[string][]Response)
+	pending := make(map[string]string) // syncId -> 请求种类
+	type event struct {
+		time time.Time
+		e    Event
+	}
+	var events []event
+	for _, r := range records {
+		switch r.Direction {
+		case miraihttp.RecordOutbound:
+			cmd := &Command{}
+			if err := json.Unmarshal(r.Frame, cmd); err == nil {
+				pending[cmd.SyncId] = replayKey(cmd.Command, cmd.SubCommand)
+			}
+		case miraihttp.RecordInbound:
+			var frame struct {
+				SyncId string          `json:"syncId"`
+				Data   json.RawMessage `json:"data"`
+			}
+			if err := json.Unmarshal(r.Frame, &frame); err != nil {
+				continue
+			}
+			data, err := decodeObject(frame.Data)
+			if err != nil {
+				continue
+			}
+			if len(frame.SyncId) > 0 && frame.SyncId[0] != '-' {
+				if key, ok := pending[frame.SyncId]; ok {
+					delete(pending, frame.SyncId)
+					responses[key] = append(responses[key], data)
+				}
+			} else if _, ok := data["type"]; ok {
+				// 没有type的是连接时的认证结果
+				events = append(events, event{r.Time, data})
+			}
+		}
+	}
+	s.lock.Lock()
+	s.replay = responses
+	s.lock.Unlock()
+	for i, e := range events {
+		if speed > 0 && i > 0 {
+			timer := time.NewTimer(time.Duration(float64(e.time.Sub(events[i-1].time)) / speed))
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+				return ctx.Err()
+			}
+		} else if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := s.Inject(e.e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package miraitest
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	miraihttp "github.com/CuteReimu/mirai-sdk-http"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+// listenFriendCount 收到群消息时查询好友数并回复
+func listenFriendCount(b *miraihttp.Bot) {
+	b.ListenGroupMessage(func(message *miraihttp.GroupMessage) bool {
+		friends, err := b.FriendList()
+		if err != nil {
+			return true
+		}
+		_, _ = message.Reply(b, miraihttp.MessageChain{&miraihttp.Plain{Text: fmt.Sprint(len(friends))}})
+		return true
+	})
+}
+
+func replyTexts(t *testing.T, s *Server, n int) []string {
+	var ret []string
+	for i := 0; i < n; i++ {
+		cmd, err := s.WaitCommand("sendGroupMessage", time.Second)
+		require.NoError(t, err)
+		var content struct {
+			MessageChain miraihttp.MessageChain `json:"messageChain"`
+		}
+		require.NoError(t, cmd.Decode(&content))
+		ret = append(ret, content.MessageChain.PlainText())
+	}
+	return ret
+}
+
+func TestReplay(t *testing.T) {
+	s := NewServer("key", 123)
+	defer s.Close()
+	b, err := s.Connect(false)
+	require.NoError(t, err)
+	buf := &bytes.Buffer{}
+	b.SetTrafficRecorder(buf)
+	listenFriendCount(b)
+
+	sender := miraihttp.Member{Id: 2, Group: miraihttp.Group{Id: 100}}
+	s.Respond("friendList", OK([]miraihttp.Friend{{Id: 1}}))
+	require.NoError(t, s.Inject(GroupMessage(sender, &miraihttp.Plain{Text: "a"})))
+	assert.Equal(t, []string{"1"}, replyTexts(t, s, 1))
+	s.Respond("friendList", OK([]miraihttp.Friend{{Id: 1}, {Id: 2}}))
+	require.NoError(t, s.Inject(GroupMessage(sender, &miraihttp.Plain{Text: "b"})))
+	assert.Equal(t, []string{"2"}, replyTexts(t, s, 1))
+	b.SetTrafficRecorder(nil)
+
+	records, err := miraihttp.ReadTrafficRecords(buf)
+	require.NoError(t, err)
+	require.NotEmpty(t, records)
+
+	// 重放时服务端不再设置friendList的返回，只能从录制中获得
+	s2 := NewServer("key", 123)
+	defer s2.Close()
+	b2, err := s2.Connect(false)
+	require.NoError(t, err)
+	listenFriendCount(b2)
+	require.NoError(t, s2.Replay(context.Background(), records, 10))
+	assert.Equal(t, []string{"1", "2"}, replyTexts(t, s2, 2))
+}
@@ -0,0 +1,245 @@
+// Package miraitest 提供一个进程内的mirai-api-http ws服务端，用于测试Bot
+package miraitest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	miraihttp "github.com/CuteReimu/mirai-sdk-http"
+	"github.com/CuteReimu/mirai-sdk-http/internal/fakemirai"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Command Bot发来的一条请求
+type Command struct {
+	SyncId     string          `json:"syncId"`
+	Command    string          `json:"command"`
+	SubCommand string          `json:"subCommand,omitempty"`
+	Content    json.RawMessage `json:"content,omitempty"`
+	Time       time.Time       `json:"-"` // 收到请求的时间
+}
+
+// Command 中的syncId在请求中是数字，返回时是字符串
+func (c *Command) UnmarshalJSON(data []byte) error {
+	type command Command
+	var v struct {
+		command
+		SyncId json.Number `json:"syncId"`
+	}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	*c = Command(v.command)
+	c.SyncId = v.SyncId.String()
+	return nil
+}
+
+// Decode 把请求的内容解析到v中
+func (c *Command) Decode(v any) error {
+	return json.Unmarshal(c.Content, v)
+}
+
+// Response 请求的返回内容，即ws消息中的data字段
+type Response map[string]any
+
+// OK 成功的返回，内容放在data字段中
+func OK(data any) Response {
+	return Response{"code": 0, "msg": "", "data": data}
+}
+
+// Fail 失败的返回
+func Fail(code int, msg string) Response {
+	return Response{"code": code, "msg": msg}
+}
+
+// MessageId 发送消息成功的返回
+func MessageId(messageId int64) Response {
+	return Response{"code": 0, "msg": "", "messageId": messageId}
+}
+
+// Responder 根据请求生成返回内容
+type Responder func(cmd *Command) Response
+
+// Server 模拟mirai-api-http的ws服务端。会记录Bot发来的所有请求，可以给每种请求设置返回内容，也可以向Bot推送消息和事件。
+//
+// 没有设置返回内容的请求，如果是"send"开头"Message"结尾的，返回一个自增的消息id，否则返回 OK(nil)
+type Server struct {
+	VerifyKey string
+	QQ        int64
+
+	server     *fakemirai.Server
+	messageId  atomic.Int64
+	lock       sync.Mutex
+	commands   []*Command
+	waited     map[string]int // 每种请求已经被 WaitCommand 取走的个数
+	responders map[string]Responder
+	replay     map[string][]Response // Replay 时录制的返回，按请求种类排队
+	changed    chan struct{}         // 收到新的请求或者新的连接时关闭并替换
+}
+
+// NewServer 启动一个模拟的服务端，用完后需要调用 Close
+func NewServer(verifyKey string, qq int64) *Server {
+	s := &Server{
+		VerifyKey:  verifyKey,
+		QQ:         qq,
+		waited:     make(map[string]int),
+		responders: make(map[string]Responder),
+		changed:    make(chan struct{}),
+	}
+	s.server = fakemirai.New(verifyKey, qq, s.handle, func() {
+		s.lock.Lock()
+		defer s.lock.Unlock()
+		s.notify()
+	})
+	return s
+}
+
+// Host 服务端的地址
+func (s *Server) Host() string {
+	return s.server.Host()
+}
+
+// Port 服务端的端口
+func (s *Server) Port() int {
+	return s.server.Port()
+}
+
+// Connect 用 miraihttp.Connect 连接到这个服务端，并等待握手完成
+func (s *Server) Connect(concurrentEvent bool) (*miraihttp.Bot, error) {
+	b, err := miraihttp.Connect(s.Host(), s.Port(), miraihttp.WsChannelAll, s.VerifyKey, s.QQ, concurrentEvent)
+	if err != nil {
+		return nil, err
+	}
+	if err = s.WaitConnected(5 * time.Second); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// Close 断开所有连接并关闭服务端
+func (s *Server) Close() {
+	s.server.Close()
+}
+
+func (s *Server) notify() {
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+func (s *Server) handle(buf []byte) (string, any) {
+	cmd := &Command{}
+	if err := json.Unmarshal(buf, cmd); err != nil {
+		return fakemirai.BadRequest(err)
+	}
+	cmd.Time = time.Now()
+	return cmd.SyncId, s.respond(cmd)
+}
+
+func (s *Server) respond(cmd *Command) Response {
+	s.lock.Lock()
+	s.commands = append(s.commands, cmd)
+	s.notify()
+	key := replayKey(cmd.Command, cmd.SubCommand)
+	if queue := s.replay[key]; len(queue) > 0 {
+		s.replay[key] = queue[1:]
+		s.lock.Unlock()
+		return queue[0]
+	}
+	f := s.responders[cmd.Command]
+	s.lock.Unlock()
+	if f != nil {
+		return f(cmd)
+	}
+	if strings.HasPrefix(cmd.Command, "send") && strings.HasSuffix(cmd.Command, "Message") {
+		return MessageId(s.messageId.Add(1))
+	}
+	return OK(nil)
+}
+
+// Handle 设置某种请求的返回内容
+func (s *Server) Handle(command string, f Responder) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.responders[command] = f
+}
+
+// Respond 设置某种请求总是返回固定的内容
+func (s *Server) Respond(command string, r Response) {
+	s.Handle(command, func(*Command) Response { return r })
+}
+
+// Commands 获取收到的所有请求，command为空串表示所有种类的请求
+func (s *Server) Commands(command string) []*Command {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	var ret []*Command
+	for _, cmd := range s.commands {
+		if command == "" || cmd.Command == command {
+			ret = append(ret, cmd)
+		}
+	}
+	return ret
+}
+
+// Reset 清空收到的请求记录，不影响设置的返回内容
+func (s *Server) Reset() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.commands = nil
+	s.waited = make(map[string]int)
+}
+
+// WaitCommand 等待下一个还没有被 WaitCommand 取走的某种请求，command为空串表示任意种类的请求
+func (s *Server) WaitCommand(command string, timeout time.Duration) (*Command, error) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		s.lock.Lock()
+		n := s.waited[command]
+		for _, cmd := range s.commands {
+			if command != "" && cmd.Command != command {
+				continue
+			}
+			if n == 0 {
+				s.waited[command]++
+				s.lock.Unlock()
+				return cmd, nil
+			}
+			n--
+		}
+		changed := s.changed
+		s.lock.Unlock()
+		select {
+		case <-changed:
+		case <-timer.C:
+			return nil, fmt.Errorf("wait command %q timeout", command)
+		}
+	}
+}
+
+// WaitConnected 等待至少有一个Bot连接上
+func (s *Server) WaitConnected(timeout time.Duration) error {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		s.lock.Lock()
+		changed := s.changed
+		s.lock.Unlock()
+		if s.server.Connected() > 0 {
+			return nil
+		}
+		select {
+		case <-changed:
+		case <-timer.C:
+			return errors.New("wait connected timeout")
+		}
+	}
+}
+
+// Inject 向所有连接的Bot推送一条消息或事件
+func (s *Server) Inject(e Event) error {
+	return s.server.Push(e)
+}
@@ -0,0 +1,48 @@
+package miraitest
+
+import (
+	miraihttp "github.com/CuteReimu/mirai-sdk-http"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestServer(t *testing.T) {
+	s := NewServer("key", 123)
+	defer s.Close()
+	b, err := s.Connect(false)
+	require.NoError(t, err)
+
+	s.Respond("friendList", OK([]miraihttp.Friend{{Id: 1, Nickname: "a"}}))
+	friends, err := b.FriendList()
+	require.NoError(t, err)
+	require.Len(t, friends, 1)
+	assert.Equal(t, "a", friends[0].Nickname)
+
+	s.Respond("groupList", Fail(5, "指定对象不存在"))
+	_, err = b.GroupList()
+	assert.Error(t, err)
+
+	b.ListenGroupMessage(func(message *miraihttp.GroupMessage) bool {
+		_, _ = message.Reply(b, miraihttp.MessageChain{&miraihttp.Plain{Text: "pong " + message.MessageChain.PlainText()}})
+		return true
+	})
+	sender := miraihttp.Member{Id: 2, MemberName: "b", Group: miraihttp.Group{Id: 100}}
+	require.NoError(t, s.Inject(GroupMessage(sender, &miraihttp.Plain{Text: "ping"})))
+	cmd, err := s.WaitCommand("sendGroupMessage", time.Second)
+	require.NoError(t, err)
+	var content struct {
+		Target       int64                  `json:"target"`
+		MessageChain miraihttp.MessageChain `json:"messageChain"`
+	}
+	require.NoError(t, cmd.Decode(&content))
+	assert.Equal(t, int64(100), content.Target)
+	assert.Equal(t, "pong ping", content.MessageChain.PlainText())
+
+	_, err = s.WaitCommand("sendGroupMessage", 50*time.Millisecond)
+	assert.Error(t, err)
+	assert.Len(t, s.Commands(""), 3)
+	s.Reset()
+	assert.Empty(t, s.Commands(""))
+}
@@ -0,0 +1,50 @@
+package miraihttp
+
+import (
+	"fmt"
+	"log/slog"
+	"reflect"
+)
+
+// HandlerInfo 监听函数的信息
+type HandlerInfo struct {
+	EventType string // 监听的事件类型，例如"GroupMessage"
+	Index     int    // 这是该事件类型的第几个监听函数，从0开始
+	Site      string // 注册监听的位置，格式为 文件:行号
+}
+
+// PanicHandler 监听函数panic时的回调，event-正在处理的事件，handler-发生panic的监听函数，recovered-recover()的返回值，stack-调用栈
+type PanicHandler func(event any, handler HandlerInfo, recovered any, stack []byte)
+
+// OnPanic 设置监听函数panic时的回调。无论是否设置，panic都会被recover并记录日志，并且不再执行该事件的后续监听函数
+func (b *Bot) OnPanic(f PanicHandler) {
+	b.panicHandler.Store(&f)
+}
+
+// NotifyPanicTo 监听函数panic时，通过好友消息通知指定的QQ号，为0表示不通知
+func (b *Bot) NotifyPanicTo(qq int64) {
+	b.panicNotifyQQ.Store(qq)
+}
+
+func (b *Bot) reportPanic(event any, handler HandlerInfo, recovered any, stack []byte) {
+	slog.Error("panic recovered", "error", recovered, "eventType", handler.EventType, "site", handler.Site, "stack", string(stack))
+	if f := b.panicHandler.Load(); f != nil && *f != nil {
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					slog.Error("panic recovered in panic handler", "error", r)
+				}
+			}()
+			(*f)(event, handler, recovered, stack)
+		}()
+	}
+	if qq := b.panicNotifyQQ.Load(); qq != 0 {
+		text := fmt.Sprintf("监听函数发生panic\n事件：%s(%s)\n注册位置：%s\n错误：%v",
+			handler.EventType, reflect.TypeOf(event), handler.Site, recovered)
+		go func() {
+			if _, err := b.SendFriendMessage(qq, 0, MessageChain{&Plain{Text: text}}); err != nil {
+				slog.Error("notify panic failed", "error", err)
+			}
+		}()
+	}
+}
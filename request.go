@@ -32,7 +32,19 @@ func (b *Bot) BotList() ([]int64, error) {
 }
 
 // MessageFromId 通过messageId获取消息，target-好友或QQ群，视情况返回 FriendMessage, GroupMessage, TempMessage, StrangerMessage
+//
+// 如果设置了 MessageStore ，会优先从本地获取
 func (b *Bot) MessageFromId(messageId, target int64) (any, error) {
+	if s := b.getMessageStore(); s != nil {
+		if m, ok := s.Get(target, messageId); ok {
+			return m, nil
+		}
+	}
+	return b.messageFromServer(messageId, target)
+}
+
+// messageFromServer 从mirai获取消息，不使用 MessageStore
+func (b *Bot) messageFromServer(messageId, target int64) (any, error) {
 	result, err := b.request2("messageFromId", "", &struct {
 		MessageId int64 `json:"messageId"`
 		Target    int64 `json:"target"`
@@ -57,8 +69,9 @@ func (b *Bot) MessageFromId(messageId, target int64) (any, error) {
 	return nil, errors.New(e)
 }
 
-// SendFriendMessage 发送好友消息，qq-目标好友的QQ号，quote-引用回复的消息，messageChain-发送的内容，返回消息id
+// SendFriendMessage 发送好友消息，qq-目标好友的QQ号，quote-引用回复的消息（为0时使用消息链中的 Quote ），messageChain-发送的内容，返回消息id
 func (b *Bot) SendFriendMessage(qq, quote int64, messageChain MessageChain) (int64, error) {
+	quote, messageChain = extractQuote(quote, messageChain)
 	result, err := b.request2("sendFriendMessage", "", &struct {
 		Target       int64        `json:"target"`
 		Quote        int64        `json:"quote,omitempty"`
@@ -67,11 +80,13 @@ func (b *Bot) SendFriendMessage(qq, quote int64, messageChain MessageChain) (int
 	if err != nil {
 		return 0, err
 	}
+	b.storeSent(&SentMessage{Target: Subject{Kind: KindFriend, Id: qq}, MessageChain: b.sentChain(result.Int(), messageChain)})
 	return result.Int(), nil
 }
 
-// SendGroupMessage 发送群消息，group-群号，quote-引用回复的消息，messageChain-发送的内容，返回消息id
+// SendGroupMessage 发送群消息，group-群号，quote-引用回复的消息（为0时使用消息链中的 Quote ），messageChain-发送的内容，返回消息id
 func (b *Bot) SendGroupMessage(group, quote int64, messageChain MessageChain) (int64, error) {
+	quote, messageChain = extractQuote(quote, messageChain)
 	result, err := b.request2("sendGroupMessage", "", &struct {
 		Target       int64        `json:"target"`
 		Quote        int64        `json:"quote,omitempty"`
@@ -80,11 +95,13 @@ func (b *Bot) SendGroupMessage(group, quote int64, messageChain MessageChain) (i
 	if err != nil {
 		return 0, err
 	}
+	b.storeSent(&SentMessage{Target: Subject{Kind: KindGroup, Id: group}, MessageChain: b.sentChain(result.Int(), messageChain)})
 	return result.Int(), nil
 }
 
-// SendTempMessage 发送临时会话消息，qq-临时会话对象QQ号，group-临时会话群号，quote-引用回复的消息，messageChain-发送的内容，返回消息id
+// SendTempMessage 发送临时会话消息，qq-临时会话对象QQ号，group-临时会话群号，quote-引用回复的消息（为0时使用消息链中的 Quote ），messageChain-发送的内容，返回消息id
 func (b *Bot) SendTempMessage(qq, group, quote int64, messageChain MessageChain) (int64, error) {
+	quote, messageChain = extractQuote(quote, messageChain)
 	result, err := b.request2("sendTempMessage", "", &struct {
 		QQ           int64        `json:"qq"`
 		Group        int64        `json:"group"`
@@ -94,6 +111,7 @@ func (b *Bot) SendTempMessage(qq, group, quote int64, messageChain MessageChain)
 	if err != nil {
 		return 0, err
 	}
+	b.storeSent(&SentMessage{Target: Subject{Kind: KindTemp, Id: qq, Group: group}, MessageChain: b.sentChain(result.Int(), messageChain)})
 	return result.Int(), nil
 }
 
@@ -426,34 +444,51 @@ func (b *Bot) UserProfile(qq int64) (*Profile, error) {
 	return profile, nil
 }
 
-type FileParam struct {
-	Id     string `json:"id"`               // 文件夹id, 空串为根目录
-	Path   string `json:"path,omitempty"`   // 文件夹路径, 文件夹允许重名, 不保证准确, 准确定位使用 id
+// FileLocation 文件或文件夹的位置，是所有文件操作的参数中共有的部分
+type FileLocation struct {
+	Id     string `json:"id"`               // 文件或文件夹id, 空串为根目录
+	Path   string `json:"path,omitempty"`   // 文件或文件夹路径, 文件夹允许重名, 不保证准确, 准确定位使用 id
 	Target int64  `json:"target,omitempty"` // 群号或好友QQ号
 	Group  int64  `json:"group,omitempty"`  // 群号
 	QQ     int64  `json:"qq,omitempty"`     // 好友QQ号
+}
 
-	// 以下是查看文件列表 GetFileList 获取文件信息 GetFileInfo 时可选
-
+// FileListParam 查看文件列表 GetFileList 的参数，FileLocation 是要查看的文件夹
+type FileListParam struct {
+	FileLocation
 	WithDownloadInfo bool `json:"withDownloadInfo,omitempty"` // 是否携带下载信息。额外请求，无必要不要携带
+	Offset           int  `json:"offset,omitempty"`           // 分页偏移
+	Size             int  `json:"size,omitempty"`             // 分页大小
+}
 
-	// 以下是查看文件列表 GetFileList 时需要
-
-	Offset int `json:"offset,omitempty"` // 分页偏移
-	Size   int `json:"size,omitempty"`   // 分页大小
-
-	// 以下是创建文件夹 FileMkdir 时需要
+// FileInfoParam 获取文件信息 GetFileInfo 的参数
+type FileInfoParam struct {
+	FileLocation
+	WithDownloadInfo bool `json:"withDownloadInfo,omitempty"` // 是否携带下载信息。额外请求，无必要不要携带
+}
 
-	DirectoryName string `json:"directoryName,omitempty"` // 新建文件夹名
+// FileMkdirParam 创建文件夹 FileMkdir 的参数，FileLocation 是新文件夹所在的文件夹
+type FileMkdirParam struct {
+	FileLocation
+	DirectoryName string `json:"directoryName"` // 新建文件夹名
+}
 
-	// 以下是移动文件 FileMove 时需要
+// FileDeleteParam 删除文件 FileDelete 的参数
+type FileDeleteParam struct {
+	FileLocation
+}
 
+// FileMoveParam 移动文件 FileMove 的参数
+type FileMoveParam struct {
+	FileLocation
 	MoveTo     string `json:"moveTo,omitempty"`     // 移动目标文件夹id
 	MoveToPath string `json:"moveToPath,omitempty"` // 移动目标文件路径, 文件夹允许重名, 不保证准确, 准确定位使用 MoveTo
+}
 
-	// 以下是重命名文件 FileRename 时需要
-
-	RenameTo string `json:"renameTo,omitempty"` // 新文件名
+// FileRenameParam 重命名文件 FileRename 的参数
+type FileRenameParam struct {
+	FileLocation
+	RenameTo string `json:"renameTo"` // 新文件名
 }
 
 type FileDownloadInfo struct {
@@ -471,6 +506,7 @@ type FileInfo struct {
 	Id           string `json:"id"`
 	Path         string `json:"path"`
 	Parent       any    `json:"parent"`
+	Size         int64  `json:"size"`
 	Contact      Group  `json:"contact"`
 	IsFile       bool   `json:"isFile"`
 	IsDictionary bool   `json:"isDictionary"`
@@ -488,7 +524,7 @@ type FileInfo struct {
 }
 
 // GetFileList 查看文件列表
-func (b *Bot) GetFileList(param FileParam) ([]*FileInfo, error) {
+func (b *Bot) GetFileList(param FileListParam) ([]*FileInfo, error) {
 	result, err := b.request2("file_list", "", param)
 	if err != nil {
 		return nil, err
@@ -503,7 +539,7 @@ func (b *Bot) GetFileList(param FileParam) ([]*FileInfo, error) {
 }
 
 // GetFileInfo 获取文件信息
-func (b *Bot) GetFileInfo(param FileParam) (*FileInfo, error) {
+func (b *Bot) GetFileInfo(param FileInfoParam) (*FileInfo, error) {
 	result, err := b.request2("file_info", "", param)
 	if err != nil {
 		return nil, err
@@ -518,7 +554,7 @@ func (b *Bot) GetFileInfo(param FileParam) (*FileInfo, error) {
 }
 
 // FileMkdir 创建文件夹
-func (b *Bot) FileMkdir(param FileParam) (*FileInfo, error) {
+func (b *Bot) FileMkdir(param FileMkdirParam) (*FileInfo, error) {
 	result, err := b.request2("file_mkdir", "", param)
 	if err != nil {
 		return nil, err
@@ -533,28 +569,19 @@ func (b *Bot) FileMkdir(param FileParam) (*FileInfo, error) {
 }
 
 // FileDelete 删除文件
-func (b *Bot) FileDelete(param FileParam) error {
-	result, err := b.request2("file_mkdir", "", param)
-	if err != nil {
-		return err
-	}
-	code := result.Get("code").Int()
-	if code != 0 {
-		e := fmt.Sprint("file_mkdir failed: ", result.Get("msg").String(), ", code:", code)
-		slog.Error(e)
-		return errors.New(e)
-	}
-	return nil
+func (b *Bot) FileDelete(param FileDeleteParam) error {
+	_, err := b.request2("file_delete", "", param)
+	return err
 }
 
 // FileMove 移动文件
-func (b *Bot) FileMove(param FileParam) error {
+func (b *Bot) FileMove(param FileMoveParam) error {
 	_, err := b.request2("file_move", "", param)
 	return err
 }
 
 // FileRename 重命名文件
-func (b *Bot) FileRename(param FileParam) error {
+func (b *Bot) FileRename(param FileRenameParam) error {
 	_, err := b.request2("file_rename", "", param)
 	return err
 }
@@ -0,0 +1,138 @@
+package miraihttp
+
+import (
+	"context"
+	"log/slog"
+	"runtime/debug"
+)
+
+type waiter struct {
+	filter func(message any) bool
+	ch     chan any
+	parked bool // 是否交出了处理事件的协程，计入 EventStats.Parked
+}
+
+// WaitNext 等待下一条满足filter的消息或事件，ctx结束时返回ctx.Err()。
+// 被等待到的消息会直接交给调用者，不会再交给监听函数处理。
+//
+// filter会在读取消息的协程中被调用，因此应当尽快返回，并且不要调用 Bot 的任何请求方法。
+//
+// 在用 ListenContext 注册的监听函数中，传入它收到的ctx（或者由它派生的ctx）调用本方法时，
+// 等待期间不会占用处理事件的协程：单线程模式或 Bot.SetKeyedDispatch 下，
+// 同一个队列中的其它事件会继续被处理，等待结束后，等到正在处理的那个事件处理完，调用者才会继续执行，
+// 因此同一个队列中的监听函数仍然不会同时执行，但是等待期间的事件会先于调用者后续的代码被处理。
+// 监听函数自己启动的协程用这个ctx等待时也是如此。
+// 其它情况下，以及设置了 DispatchOption.HandlerTimeout 时，等待期间仍然会占用处理事件的协程。
+func (b *Bot) WaitNext(ctx context.Context, filter func(message any) bool) (any, error) {
+	c, _ := ctx.Value(handlerCallKey{}).(*handlerCall)
+	w := &waiter{filter: filter, ch: make(chan any, 1)}
+	if c != nil && c.park() {
+		w.parked = true
+		defer c.unpark()
+	}
+	b.waiterLock.Lock()
+	b.waiters = append(b.waiters, w)
+	b.stats.waiting.Add(1)
+	if w.parked {
+		b.stats.parked.Add(1)
+	}
+	b.waiterLock.Unlock()
+	select {
+	case m := <-w.ch:
+		return m, nil
+	case <-ctx.Done():
+		if !b.removeWaiter(w) {
+			// 在ctx结束的同时已经等到了消息
+			return <-w.ch, nil
+		}
+		return nil, ctx.Err()
+	}
+}
+
+// WaitNextMessage 等待下一条类型为M并且满足filter的消息，filter为nil表示不过滤
+//
+//	m, err := WaitNextMessage(ctx, b, func(m *GroupMessage) bool { return m.Sender.Id == qq })
+func WaitNextMessage[M any](ctx context.Context, b *Bot, filter func(message M) bool) (M, error) {
+	m, err := b.WaitNext(ctx, func(message any) bool {
+		m, ok := message.(M)
+		return ok && (filter == nil || filter(m))
+	})
+	if err != nil {
+		var zero M
+		return zero, err
+	}
+	return m.(M), nil
+}
+
+// WaitNextFromSender 等待同一个人在同一个群中发送的下一条消息
+func (m *GroupMessage) WaitNextFromSender(ctx context.Context, b *Bot) (*GroupMessage, error) {
+	return WaitNextMessage(ctx, b, func(message *GroupMessage) bool {
+		return message.Sender.Id == m.Sender.Id && message.Sender.Group.Id == m.Sender.Group.Id
+	})
+}
+
+// WaitNextFromSender 等待同一个好友发送的下一条消息
+func (m *FriendMessage) WaitNextFromSender(ctx context.Context, b *Bot) (*FriendMessage, error) {
+	return WaitNextMessage(ctx, b, func(message *FriendMessage) bool {
+		return message.Sender.Id == m.Sender.Id
+	})
+}
+
+// WaitNextFromSender 等待同一个人在同一个群临时会话中发送的下一条消息
+func (m *TempMessage) WaitNextFromSender(ctx context.Context, b *Bot) (*TempMessage, error) {
+	return WaitNextMessage(ctx, b, func(message *TempMessage) bool {
+		return message.Sender.Id == m.Sender.Id && message.Sender.Group.Id == m.Sender.Group.Id
+	})
+}
+
+func (b *Bot) hasWaiter() bool {
+	b.waiterLock.Lock()
+	defer b.waiterLock.Unlock()
+	return len(b.waiters) > 0
+}
+
+// removeWaiter 移除等待者，如果已经被移除（即已经等到了消息）则返回false
+func (b *Bot) removeWaiter(w *waiter) bool {
+	b.waiterLock.Lock()
+	defer b.waiterLock.Unlock()
+	for i := range b.waiters {
+		if b.waiters[i] == w {
+			b.removeWaiterAt(i)
+			return true
+		}
+	}
+	return false
+}
+
+// deliverToWaiter 把消息交给第一个满足条件的等待者，如果没有则返回false
+func (b *Bot) deliverToWaiter(m any) bool {
+	b.waiterLock.Lock()
+	defer b.waiterLock.Unlock()
+	for i, w := range b.waiters {
+		if matchWaiter(w, m) {
+			b.removeWaiterAt(i)
+			w.ch <- m
+			return true
+		}
+	}
+	return false
+}
+
+// removeWaiterAt 移除第i个等待者，调用时需要持有waiterLock
+func (b *Bot) removeWaiterAt(i int) {
+	if b.waiters[i].parked {
+		b.stats.parked.Add(-1)
+	}
+	b.waiters = append(b.waiters[:i], b.waiters[i+1:]...)
+	b.stats.waiting.Add(-1)
+}
+
+func matchWaiter(w *waiter, m any) (ok bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			slog.Error("panic recovered in wait filter", "error", r, "stack", string(debug.Stack()))
+			ok = false
+		}
+	}()
+	return w.filter(m)
+}
@@ -0,0 +1,109 @@
+package miraihttp
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWaitNext(t *testing.T) {
+	b := newBot(0)
+	first := &GroupMessage{Sender: Member{Id: 1, Group: Group{Id: 2}}}
+	done := make(chan *GroupMessage)
+	go func() {
+		m, err := first.WaitNextFromSender(context.Background(), b)
+		assert.Nil(t, err)
+		done <- m
+	}()
+	assert.Eventually(t, b.hasWaiter, time.Second, time.Millisecond)
+	assert.False(t, b.deliverToWaiter(&GroupMessage{Sender: Member{Id: 1, Group: Group{Id: 3}}}))
+	assert.False(t, b.deliverToWaiter(&FriendMessage{Sender: Friend{Id: 1}}))
+	next := &GroupMessage{Sender: Member{Id: 1, Group: Group{Id: 2}}}
+	assert.True(t, b.deliverToWaiter(next))
+	assert.Same(t, next, <-done)
+	assert.False(t, b.hasWaiter())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := b.WaitNext(ctx, func(any) bool { return true })
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.False(t, b.hasWaiter())
+}
+
+func TestWaitNextSerial(t *testing.T) {
+	s, b := newTestBot(t, nil)
+	var active, maxActive atomic.Int32
+	enter := func() {
+		n := active.Add(1)
+		if n > maxActive.Load() {
+			maxActive.Store(n)
+		}
+	}
+	handled := make(chan string, 10)
+	ListenContext(b, func(ctx context.Context, message *GroupMessage) bool {
+		enter()
+		defer active.Add(-1)
+		text := message.MessageChain.String()
+		if text != "start" {
+			handled <- text
+			return true
+		}
+		active.Add(-1)
+		next, err := message.WaitNextFromSender(ctx, b)
+		enter()
+		assert.Nil(t, err)
+		handled <- "start " + next.MessageChain.String()
+		return true
+	})
+	push := func(group int64, text string) {
+		s.Push(t, `{"type":"GroupMessage","sender":{"id":1,"group":{"id":`+strconv.FormatInt(group, 10)+`}},"messageChain":[{"type":"Plain","text":"`+text+`"}]}`)
+	}
+	push(1, "start")
+	assert.Eventually(t, func() bool { return b.EventStats().Parked == 1 }, time.Second, time.Millisecond)
+	// 另一个群的消息在等待期间也能被处理
+	push(2, "other")
+	assert.Equal(t, "other", <-handled)
+	push(1, "next")
+	assert.Equal(t, "start next", <-handled)
+	assert.Eventually(t, func() bool { return b.EventStats() == EventStats{Processed: 2} }, time.Second, time.Millisecond)
+	assert.Equal(t, int32(1), maxActive.Load())
+}
+
+func TestWaitNextInSpawnedGoroutine(t *testing.T) {
+	s, b := newTestBot(t, nil)
+	handled := make(chan string, 10)
+	ListenContext(b, func(ctx context.Context, message *GroupMessage) bool {
+		text := message.MessageChain.String()
+		if text != "start" {
+			handled <- text
+			return true
+		}
+		// 在监听函数自己启动的协程中用它的ctx等待，同样会交出处理事件的协程
+		result := make(chan string)
+		go func() {
+			next, err := message.WaitNextFromSender(ctx, b)
+			assert.Nil(t, err)
+			result <- "start " + next.MessageChain.String()
+		}()
+		handled <- <-result
+		return true
+	})
+	push := func(group int64, text string) {
+		s.Push(t, `{"type":"GroupMessage","sender":{"id":1,"group":{"id":`+strconv.FormatInt(group, 10)+`}},"messageChain":[{"type":"Plain","text":"`+text+`"}]}`)
+	}
+	push(1, "start")
+	assert.Eventually(t, func() bool { return b.EventStats().Parked == 1 }, time.Second, time.Millisecond)
+	push(2, "other")
+	assert.Equal(t, "other", <-handled)
+	push(1, "next")
+	assert.Equal(t, "start next", <-handled)
+	assert.Eventually(t, func() bool { return b.EventStats() == EventStats{Processed: 2} }, time.Second, time.Millisecond)
+
+	// 不是用监听函数的ctx等待时不会交出处理事件的协程
+	go func() { _, _ = b.WaitNext(context.Background(), func(any) bool { return false }) }()
+	assert.Eventually(t, func() bool { return b.EventStats().Waiting == 1 }, time.Second, time.Millisecond)
+	assert.Zero(t, b.EventStats().Parked)
+}
@@ -0,0 +1,94 @@
+package miraihttp
+
+import (
+	"encoding/json"
+	"github.com/CuteReimu/mirai-sdk-http/internal/fakemirai"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+	"sync"
+	"testing"
+)
+
+// testRequest Bot发给 testServer 的一条请求
+type testRequest struct {
+	Command    string
+	SubCommand string
+	Content    gjson.Result
+}
+
+// testServer 测试用的mirai-api-http，记录Bot发来的请求，并用handle的返回值作为结果中的data。
+// 结果中的messageId是请求的序号，从1开始。
+// 包内的测试不能引用 miraitest ，两者的协议部分都由 fakemirai 实现
+type testServer struct {
+	server   *fakemirai.Server
+	lock     sync.Mutex
+	handle   func(req *testRequest) any
+	requests []*testRequest
+}
+
+// newTestBot 启动一个 testServer 并用单线程的方式连接，handle为nil表示data总是null
+func newTestBot(t *testing.T, handle func(req *testRequest) any) (*testServer, *Bot) {
+	s := &testServer{handle: handle}
+	s.server = fakemirai.New("", 1, s.respond, nil)
+	t.Cleanup(s.server.Close)
+	b, err := Connect(s.server.Host(), s.server.Port(), WsChannelAll, "", 1, false)
+	require.NoError(t, err)
+	return s, b
+}
+
+func (s *testServer) respond(buf []byte) (string, any) {
+	var v any
+	if err := json.Unmarshal(buf, &v); err != nil {
+		return fakemirai.BadRequest(err)
+	}
+	msg := gjson.ParseBytes(buf)
+	req := &testRequest{
+		Command:    msg.Get("command").String(),
+		SubCommand: msg.Get("subCommand").String(),
+		Content:    msg.Get("content"),
+	}
+	s.lock.Lock()
+	s.requests = append(s.requests, req)
+	messageId := len(s.requests)
+	s.lock.Unlock()
+	var data any
+	if s.handle != nil {
+		data = s.handle(req)
+	}
+	return msg.Get("syncId").String(), map[string]any{"code": 0, "msg": "", "data": data, "messageId": messageId}
+}
+
+// Requests 获取所有收到的请求，command不为空时只获取这种请求
+func (s *testServer) Requests(command string) []*testRequest {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	var ret []*testRequest
+	for _, req := range s.requests {
+		if command == "" || req.Command == command {
+			ret = append(ret, req)
+		}
+	}
+	return ret
+}
+
+// Last 获取最后一个请求
+func (s *testServer) Last() *testRequest {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if len(s.requests) == 0 {
+		return nil
+	}
+	return s.requests[len(s.requests)-1]
+}
+
+// Reset 清空收到的请求
+func (s *testServer) Reset() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.requests = nil
+}
+
+// Push 向Bot推送一条消息或事件，data是它的json
+func (s *testServer) Push(t *testing.T, data string) {
+	require.NoError(t, s.server.Push(json.RawMessage(data)))
+}
@@ -0,0 +1,123 @@
+package miraihttp
+
+import (
+	"context"
+	"fmt"
+	"github.com/tidwall/gjson"
+	"strconv"
+	"strings"
+)
+
+// span中使用的属性名
+const (
+	AttrEventType    = "mirai.event.type"    // 事件类型，例如"GroupMessage"
+	AttrHandlerSite  = "mirai.handler.site"  // 注册监听的位置
+	AttrHandlerIndex = "mirai.handler.index" // 这是该事件类型的第几个监听函数
+	AttrCommand      = "mirai.command"       // 请求的命令字
+	AttrSubCommand   = "mirai.sub_command"   // 请求的子命令字
+	AttrSyncId       = "mirai.sync_id"       // 请求的syncId
+	AttrGroup        = "mirai.group"         // 事件或者请求所属的群号
+	AttrFriend       = "mirai.friend"        // 事件所属的好友QQ号
+)
+
+// Attribute span的属性，Value是string、int64或bool
+type Attribute struct {
+	Key   string
+	Value any
+}
+
+// Span 一次操作的追踪记录
+type Span interface {
+	// SetAttributes 设置属性
+	SetAttributes(attrs ...Attribute)
+
+	// RecordError 记录一个错误，并把span标记为失败
+	RecordError(err error)
+
+	// End 结束span
+	End()
+}
+
+// Tracer 追踪接口，用 Bot.SetTracer 设置，OpenTelemetry的适配器见 miraiotel 包。
+//
+// 每个分发给监听函数的事件会创建一个名为"event 事件类型"的span，其中每个监听函数会创建一个名为"handler"的子span。
+// 用 ListenContext 注册的监听函数会收到监听函数span的ctx，再通过 Bot.WithContext 发送请求，
+// 每个请求会创建一个名为"request 命令字"的子span：
+//
+//	miraihttp.ListenContext(b, func(ctx context.Context, message *miraihttp.GroupMessage) bool {
+//		b := b.WithContext(ctx)
+//		_, _ = message.Reply(b, miraihttp.MessageChain{&miraihttp.Plain{Text: "hello"}})
+//		return true
+//	})
+type Tracer interface {
+	// Start 以ctx中的span为父span创建一个新的span，返回包含新span的ctx
+	Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, Span)
+}
+
+type noopSpan struct{}
+
+func (noopSpan) SetAttributes(...Attribute) {}
+
+func (noopSpan) RecordError(error) {}
+
+func (noopSpan) End() {}
+
+// SetTracer 设置追踪接口，为nil表示不追踪
+func (b *Bot) SetTracer(t Tracer) {
+	if t == nil {
+		b.tracer.Store(nil)
+		return
+	}
+	b.tracer.Store(&t)
+}
+
+// startSpan 创建一个span，attrs返回span的属性。没有设置 Tracer 时不会调用attrs，并返回原来的ctx
+func (b *Bot) startSpan(ctx context.Context, name string, attrs func() []Attribute) (context.Context, Span) {
+	if t := b.tracer.Load(); t != nil {
+		return (*t).Start(ctx, name, attrs()...)
+	}
+	return ctx, noopSpan{}
+}
+
+// eventAttributes 事件span的属性，包括事件所属的群或好友
+func eventAttributes(messageType string, data gjson.Result) []Attribute {
+	attrs := []Attribute{{AttrEventType, messageType}}
+	kind, id, _ := strings.Cut(defaultDispatchKey(messageType, data), ":")
+	if n, err := strconv.ParseInt(id, 10, 64); err == nil {
+		switch kind {
+		case "group":
+			attrs = append(attrs, Attribute{AttrGroup, n})
+		case "friend":
+			attrs = append(attrs, Attribute{AttrFriend, n})
+		}
+	}
+	return attrs
+}
+
+// groupTargetCommands content中的target是群号的命令字
+var groupTargetCommands = map[string]bool{
+	"sendGroupMessage": true, "mute": true, "unmute": true, "kick": true, "quit": true,
+	"muteAll": true, "unmuteAll": true, "setEssence": true, "groupConfig": true,
+	"memberInfo": true, "memberAdmin": true, "memberList": true, "latestMemberList": true,
+	"memberProfile": true,
+}
+
+// requestAttributes 请求span的属性，buf是编码后的请求
+func requestAttributes(command, subCommand, syncId string, buf []byte) []Attribute {
+	attrs := []Attribute{{AttrCommand, command}, {AttrSyncId, syncId}}
+	if subCommand != "" {
+		attrs = append(attrs, Attribute{AttrSubCommand, subCommand})
+	}
+	content := gjson.GetBytes(buf, "content")
+	if group := content.Get("group"); group.Exists() {
+		attrs = append(attrs, Attribute{AttrGroup, group.Int()})
+	} else if target := content.Get("target"); groupTargetCommands[command] && target.Exists() {
+		attrs = append(attrs, Attribute{AttrGroup, target.Int()})
+	}
+	return attrs
+}
+
+// panicError 监听函数panic时记录到span中的错误
+func panicError(recovered any) error {
+	return fmt.Errorf("panic: %v", recovered)
+}
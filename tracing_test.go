@@ -0,0 +1,78 @@
+package miraihttp
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestTracingAttributes(t *testing.T) {
+	assert.Equal(t, []Attribute{{AttrEventType, "GroupMessage"}, {AttrGroup, int64(2)}},
+		eventAttributes("GroupMessage", gjson.Parse(`{"sender":{"id":1,"group":{"id":2}}}`)))
+	assert.Equal(t, []Attribute{{AttrEventType, "FriendMessage"}, {AttrFriend, int64(1)}},
+		eventAttributes("FriendMessage", gjson.Parse(`{"sender":{"id":1}}`)))
+	assert.Equal(t, []Attribute{{AttrCommand, "mute"}, {AttrSyncId, "3"}, {AttrGroup, int64(100)}},
+		requestAttributes("mute", "", "3", []byte(`{"content":{"target":100,"memberId":1}}`)))
+	assert.Equal(t, []Attribute{{AttrCommand, "sendTempMessage"}, {AttrSyncId, "4"}, {AttrGroup, int64(100)}},
+		requestAttributes("sendTempMessage", "", "4", []byte(`{"content":{"qq":1,"group":100}}`)))
+	assert.Equal(t, []Attribute{{AttrCommand, "sendFriendMessage"}, {AttrSyncId, "5"}},
+		requestAttributes("sendFriendMessage", "", "5", []byte(`{"content":{"target":1}}`)))
+}
+
+func TestWithContext(t *testing.T) {
+	type key struct{}
+	b := newBot(10)
+	ctx := context.WithValue(context.Background(), key{}, 1)
+	b2 := b.WithContext(ctx)
+	assert.Equal(t, int64(10), b2.QQ)
+	assert.Same(t, b.botState, b2.botState)
+	assert.Equal(t, context.Background(), b.Context())
+	assert.Equal(t, 1, b2.Context().Value(key{}))
+}
+
+// testTracer 把span的名字和序号放在ctx中
+type testTracer struct {
+	lock  sync.Mutex
+	count int
+}
+
+type testSpanKey struct{}
+
+func (t *testTracer) Start(ctx context.Context, name string, _ ...Attribute) (context.Context, Span) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.count++
+	return context.WithValue(ctx, testSpanKey{}, name+"#"+strconv.Itoa(t.count)), noopSpan{}
+}
+
+func TestListenContext(t *testing.T) {
+	s, b := newTestBot(t, nil)
+	b.SetTracer(&testTracer{})
+	require.NoError(t, b.SetDispatchOption(DispatchOption{HandlerTimeout: 50 * time.Millisecond}))
+	release := make(chan struct{})
+	spans := make(chan any, 2)
+	ListenContext(b, func(ctx context.Context, message *GroupMessage) bool {
+		<-release
+		// 超时之后仍然拿到的是自己的ctx
+		spans <- ctx.Value(testSpanKey{})
+		return true
+	})
+	ListenContext(b, func(ctx context.Context, message *GroupMessage) bool {
+		spans <- ctx.Value(testSpanKey{})
+		return true
+	})
+	ListenContext(b, func(ctx context.Context, message *Group) bool { return true })
+	assert.Len(t, b.handler["GroupMessage"], 2)
+	assert.NotContains(t, b.handler, "Group")
+	assert.Contains(t, b.handler["GroupMessage"][0].info.Site, "tracing_test.go")
+
+	s.Push(t, `{"type":"GroupMessage","sender":{"id":1,"group":{"id":100}},"messageChain":[]}`)
+	assert.Equal(t, "handler#3", <-spans)
+	close(release)
+	assert.Equal(t, "handler#2", <-spans)
+}
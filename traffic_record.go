@@ -0,0 +1,76 @@
+package miraihttp
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+const (
+	RecordInbound  = "in"  // 收到的ws消息
+	RecordOutbound = "out" // 发出的请求
+)
+
+// TrafficRecord 录制的一条ws消息
+type TrafficRecord struct {
+	Time      time.Time       `json:"time"`
+	Direction string          `json:"direction"` // RecordInbound 或 RecordOutbound
+	Frame     json.RawMessage `json:"frame"`     // 原始的ws消息，不是合法json时保存为json字符串
+}
+
+type trafficRecorder struct {
+	lock sync.Mutex
+	w    io.Writer
+}
+
+// SetTrafficRecorder 把收到的每一条ws消息和发出的每一个请求都记录到w中，每行一条 TrafficRecord 。为nil表示停止记录。
+// 可以用 ReadTrafficRecords 读取，再用 miraitest.Server.Replay 重放
+func (b *Bot) SetTrafficRecorder(w io.Writer) {
+	if w == nil {
+		b.recorder.Store(nil)
+		return
+	}
+	b.recorder.Store(&trafficRecorder{w: w})
+}
+
+func (b *Bot) record(direction string, frame []byte) {
+	r := b.recorder.Load()
+	if r == nil {
+		return
+	}
+	record := &TrafficRecord{Time: time.Now(), Direction: direction, Frame: frame}
+	if !json.Valid(frame) {
+		record.Frame, _ = json.Marshal(string(frame))
+	}
+	buf, err := json.Marshal(record)
+	if err != nil {
+		slog.Error("json marshal failed", "error", err)
+		return
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if _, err = r.w.Write(append(buf, '\n')); err != nil {
+		slog.Error("write traffic record failed", "error", err)
+	}
+}
+
+// ReadTrafficRecords 读取 SetTrafficRecorder 记录的内容
+func ReadTrafficRecords(r io.Reader) ([]*TrafficRecord, error) {
+	var records []*TrafficRecord
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 16<<20)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		record := &TrafficRecord{}
+		if err := json.Unmarshal(scanner.Bytes(), record); err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	return records, scanner.Err()
+}
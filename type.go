@@ -16,6 +16,7 @@ const (
 	KindFriend   Kind = "Friend"   // 好友
 	KindGroup    Kind = "Group"    // 群
 	KindStranger Kind = "Stranger" // 陌生人
+	KindTemp     Kind = "Temp"     // 群临时会话，仅用于 Subject ，不能用于 Bot.SendNudge
 )
 
 type HonorAction string